@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/azurity/flow-table/render/engine"
+)
+
+var outPatternRegExp = regexp.MustCompile(`\{\{(.+?)\}\}`)
+var outLangRegExp = regexp.MustCompile(`^\s*\[\w+\]`)
+
+// outValueReplacer keeps a substituted value inside a single path element.
+var outValueReplacer = strings.NewReplacer("/", "_", "\\", "_", "..", "_")
+
+// expandOutPattern replaces each `{{field}}` with the field of the record,
+// or `{{[lang] exp}}` with the result of the expression. The path separators
+// and `..` of the values are replaced with `_`.
+func expandOutPattern(pattern string, record any, engines *engine.MultiEngine) (string, error) {
+	var err error
+	ret := outPatternRegExp.ReplaceAllStringFunc(pattern, func(match string) string {
+		code := outPatternRegExp.FindStringSubmatch(match)[1]
+		var value any
+		if outLangRegExp.MatchString(code) {
+			var evalErr error
+			value, evalErr = engines.Eval(strings.TrimSpace(code))
+			if evalErr != nil {
+				err = evalErr
+				return ""
+			}
+		} else if fields, ok := record.(map[string]any); ok {
+			value = fields[strings.TrimSpace(code)]
+		}
+		if value == nil {
+			return ""
+		}
+		return outValueReplacer.Replace(fmt.Sprint(value))
+	})
+	return ret, err
+}
+
+// renderEach renders the template once per record of the expression, each
+// with a fresh engine, and returns the count of failed files.
+func renderEach(path string, data map[string]any, opts options, each string, outPattern string) int {
+	engines, err := setupEngines(data, opts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	value, err := engines.Eval(each)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	records, ok := value.([]any)
+	if !ok {
+		records = []any{value}
+	}
+
+	failed := 0
+	// the record of each output path, case insensitive as some file systems are
+	outPaths := map[string]int{}
+	for i, record := range records {
+		err := func() error {
+			engines, err := setupEngines(data, opts)
+			if err != nil {
+				return err
+			}
+			if err := engines.SetData("record", record); err != nil {
+				return err
+			}
+			outPath, err := expandOutPattern(outPattern, record, engines)
+			if err != nil {
+				return err
+			}
+			if strings.ToLower(filepath.Ext(outPath)) != ".xlsx" {
+				outPath += ".xlsx"
+			}
+			key := strings.ToLower(filepath.Clean(outPath))
+			if first, ok := outPaths[key]; ok {
+				return fmt.Errorf("%s: same output path as record #%d", outPath, first)
+			}
+			outPaths[key] = i
+			if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+				return err
+			}
+			if err := renderFile(path, outPath, engines, opts.Render); err != nil {
+				return fmt.Errorf("%s: %w", outPath, err)
+			}
+			log.Printf("[ok] #%d %s\n", i, outPath)
+			return nil
+		}()
+		if err != nil {
+			log.Printf("[failed] #%d %v\n", i, err)
+			if table, ok := errorTable(err); ok {
+				fmt.Fprint(os.Stderr, table)
+			}
+			failed += 1
+		}
+	}
+	return failed
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExpandOutPattern(t *testing.T) {
+	engines, err := newEngines(options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pattern string
+		record  map[string]any
+		want    string
+	}{
+		{"out/{{name}}.xlsx", map[string]any{"name": "alice"}, "out/alice.xlsx"},
+		{"out/{{ id }}-{{name}}.xlsx", map[string]any{"id": 7, "name": "bob"}, "out/7-bob.xlsx"},
+		{"out/{{missing}}.xlsx", map[string]any{}, "out/.xlsx"},
+		{"out/{{[js] record.name.toUpperCase()}}.xlsx", map[string]any{"name": "carol"}, "out/CAROL.xlsx"},
+		{"out/{{name}}.xlsx", map[string]any{"name": "../../etc/passwd"}, "out/____etc_passwd.xlsx"},
+		{"out/{{name}}.xlsx", map[string]any{"name": `a\b`}, "out/a_b.xlsx"},
+		{"out/{{[js] '../x'}}.xlsx", map[string]any{}, "out/__x.xlsx"},
+	}
+	for _, test := range tests {
+		if err := engines.SetData("record", test.record); err != nil {
+			t.Fatal(err)
+		}
+		got, err := expandOutPattern(test.pattern, test.record, engines)
+		if err != nil {
+			t.Errorf("expandOutPattern(%q): %v", test.pattern, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("expandOutPattern(%q, %v) = %q, want %q", test.pattern, test.record, got, test.want)
+		}
+	}
+}
+
+func TestRenderEach(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "template.xlsx")
+	workbook := excelize.NewFile()
+	workbook.SetCellStr("Sheet1", "A1", "{{[js] record.name}}")
+	if err := workbook.SaveAs(template); err != nil {
+		t.Fatal(err)
+	}
+
+	outPattern := filepath.Join(dir, "out", "{{name}}.xlsx")
+	each := `[js] [{name: "a"}, {name: "b"}, {name: "A"}]`
+	if failed := renderEach(template, map[string]any{}, options{}, each, outPattern); failed != 1 {
+		t.Errorf("failed = %d, want 1 for the duplicate path", failed)
+	}
+	for _, name := range []string{"a", "b"} {
+		output, err := excelize.OpenFile(filepath.Join(dir, "out", name+".xlsx"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value, _ := output.GetCellValue("Sheet1", "A1"); value != name {
+			t.Errorf("%s.xlsx A1 = %q", name, value)
+		}
+		output.Close()
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("%d files written, want 2", len(entries))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/azurity/flow-table/render"
+	"github.com/azurity/flow-table/render/engine"
+	"github.com/xuri/excelize/v2"
+)
+
+// checkPrelude checks the prelude script like LoadPrelude runs it.
+func checkPrelude(engines *engine.MultiEngine, path string) (*render.CodeInfo, error) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := engines.Check(fmt.Sprintf("[%s]%s", ext, code), true)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return info, nil
+}
+
+// runLint checks the template without rendering it, and returns the exit code.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	path := flags.String("template", "", "the template xlsx")
+	dataPath := flags.String("data", "", "data files directory, the references to variables it doesn't provide are reported")
+	preludes := listFlag{}
+	flags.Var(&preludes, "prelude", "script file run before rendering, the names it defines are known, can be repeated")
+	flags.Parse(args)
+
+	file, err := excelize.OpenFile(*path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer file.Close()
+	engines, err := newEngines(options{BaseDir: filepath.Dir(*path)})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var names []string
+	if *dataPath != "" {
+		data, err := newLoader().Load(*dataPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		names = []string{}
+		for name := range data {
+			names = append(names, name)
+		}
+	}
+	failed := false
+	for _, prelude := range preludes {
+		info, err := checkPrelude(engines, prelude)
+		if err != nil {
+			log.Printf("[failed] %v\n", err)
+			failed = true
+			continue
+		}
+		if names != nil {
+			names = append(names, info.Defines...)
+		}
+	}
+
+	errs := render.Lint(file, engines, names)
+	if len(errs) > 0 {
+		fmt.Print(errs.Table())
+		log.Printf("[failed] %d problem(s) found\n", len(errs))
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	log.Println("[ok]")
+	return 0
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/azurity/flow-table/loader"
 	"github.com/azurity/flow-table/render"
@@ -13,40 +16,128 @@ import (
 	"github.com/xuri/excelize/v2"
 )
 
+// listFlag is a flag which can be repeated.
+type listFlag []string
+
+func (list *listFlag) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *listFlag) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLint(os.Args[2:]))
+	}
+
 	path := flag.String("template", "", "the template xlsx")
 	dataPath := flag.String("data", "", "data files directory")
 	outPath := flag.String("output", "output.xlsx", "output xlsx file path")
+	each := flag.String("each", "", "expression of the records, render one output file per record bound as record")
+	outPattern := flag.String("output-pattern", "", "output file path pattern of each record, such as out/{{name}}.xlsx")
+	preludes := listFlag{}
+	flag.Var(&preludes, "prelude", "script file run before rendering, the extension picks the language, can be repeated")
+	modules := flag.String("modules", "", "directory searched by require() in javascript, besides the template directory")
+	timeout := flag.Duration("timeout", 0, "time limit of each javascript or cel expression, such as 5s, 0 for no limit")
+	budget := flag.Duration("budget", 0, "time limit of rendering each file, such as 1m, 0 for no limit")
+	maxCells := flag.Int("max-cells", 0, "limit of rows x cols rendered by each formula or block, 0 for no limit")
+	maxMemory := flag.Uint64("max-memory", 0, "limit of the memory in MiB, checked before each expression, 0 for no limit")
+	celCostLimit := flag.Uint64("cel-cost-limit", 0, "limit of the estimated cost of each cel expression, 0 for no limit")
+	sandbox := flag.Bool("sandbox", false, "run the expressions without file, OS and time access, and without dynamic code")
+	clock := flag.String("clock", "", "the fixed current time in sandbox, RFC 3339 such as 2026-01-01T00:00:00Z, default is the unix epoch")
+	seed := flag.Int64("seed", 0, "the seed of the random source in sandbox")
+	policy := flag.String("policy", render.ErrorPolicy_Strict, "handling of the failed cells, strict stops at the first error, collect reports all of them, lenient marks them as #FLOW! in the output")
 	flag.Parse()
 
+	switch *policy {
+	case render.ErrorPolicy_Strict, render.ErrorPolicy_Collect, render.ErrorPolicy_Lenient:
+	default:
+		fmt.Fprintf(os.Stderr, "invalid value %q for flag -policy: must be strict, collect or lenient\n", *policy)
+		flag.Usage()
+		os.Exit(2)
+	}
 	if strings.ToLower(filepath.Ext(*path)) != ".xlsx" {
-		log.Panicln("only support *.xlsx template file")
+		log.Fatalln("only support *.xlsx template file")
 	}
 	if stat, err := os.Stat(*path); err != nil || stat.IsDir() {
 		if err != nil {
-			log.Panicln(err)
+			log.Fatalln(err)
 		} else {
-			log.Panicln("file cannot be a directory")
+			log.Fatalln("file cannot be a directory")
 		}
 	}
 	if strings.ToLower(filepath.Ext(*outPath)) != ".xlsx" {
 		*outPath += ".xlsx"
 	}
 
-	celEngine, _ := engine.NewCelEngine()
+	opts := options{
+		Preludes:     preludes,
+		BaseDir:      filepath.Dir(*path),
+		CelCostLimit: *celCostLimit,
+		Sandbox:      *sandbox,
+		Render: render.Options{
+			Timeout:   *timeout,
+			Budget:    *budget,
+			MaxCells:  *maxCells,
+			MaxMemory: *maxMemory << 20,
+			Policy:    *policy,
+			BaseDir:   filepath.Dir(*path),
+			NoFiles:   *sandbox,
+		},
+	}
+	if *modules != "" {
+		opts.Modules = append(opts.Modules, *modules)
+	}
+	opts.SandboxOptions.Seed = *seed
+	if *clock != "" {
+		value, err := time.Parse(time.RFC3339, *clock)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		opts.SandboxOptions.Clock = value
+	}
 
-	engines := engine.NewMultiEngine(map[string]render.RenderEngine{
-		"js":  engine.NewJsEngine(),
-		"py":  engine.NewPyEngine(),
-		"cel": celEngine,
-	}, map[string]string{
-		"javascript": "js",
-		"ecmascript": "js",
-		"es":         "js",
-		"python":     "py",
-	})
+	data := map[string]any{}
+	if *dataPath != "" {
+		loaded, err := newLoader().Load(*dataPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		data = loaded
+	}
+
+	if *each != "" {
+		if *outPattern == "" {
+			log.Fatalln("-output-pattern is required by -each")
+		}
+		if failed := renderEach(*path, data, opts, *each, *outPattern); failed > 0 {
+			log.Fatalf("[finish] %d file(s) failed\n", failed)
+		}
+		log.Println("[finish]")
+		return
+	}
+
+	engines, err := setupEngines(data, opts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = renderFile(*path, *outPath, engines, opts.Render)
+	if err != nil {
+		if table, ok := errorTable(err); ok {
+			fmt.Fprint(os.Stderr, table)
+			log.Fatalln("[failed]")
+		}
+		log.Fatalln("[failed]", err)
+	}
+	log.Println("[finish]")
+}
 
-	loader := &loader.DirectoryLoader{
+// newLoader returns the loader of the data directory.
+func newLoader() loader.Loader {
+	return &loader.DirectoryLoader{
 		SubLoaders: []loader.SubLoaderDesc{
 			{
 				Loader: &loader.SqliteLoader{},
@@ -69,30 +160,94 @@ func main() {
 			},
 		},
 	}
+}
 
-	if *dataPath != "" {
-		data, err := loader.Load(*dataPath)
-		if err != nil {
-			log.Panicln(err)
+// options is the setup shared by all rendered files.
+type options struct {
+	Preludes       []string
+	BaseDir        string   // the directory require() resolves relative paths from
+	Modules        []string // the directories require() searches for modules
+	CelCostLimit   uint64
+	Sandbox        bool
+	SandboxOptions engine.SandboxOptions
+	Render         render.Options
+}
+
+func newEngines(opts options) (*engine.MultiEngine, error) {
+	jsEngine := engine.NewJsEngine()
+	if !opts.Sandbox {
+		if err := jsEngine.EnableRequire(opts.BaseDir, opts.Modules...); err != nil {
+			return nil, err
 		}
-		err = engines.InitData(data)
-		if err != nil {
-			log.Panicln(err)
+	}
+	celEngine, _ := engine.NewCelEngine()
+	celEngine.SetCostLimit(opts.CelCostLimit)
+
+	engines := engine.NewMultiEngine(map[string]render.RenderEngine{
+		"js":  jsEngine,
+		"py":  engine.NewPyEngine(),
+		"cel": celEngine,
+	}, map[string]string{
+		"javascript": "js",
+		"ecmascript": "js",
+		"es":         "js",
+		"python":     "py",
+	})
+	if opts.Sandbox {
+		if err := engines.EnableSandbox(opts.SandboxOptions); err != nil {
+			return nil, err
 		}
 	}
+	return engines, nil
+}
 
-	file, err := excelize.OpenFile(*path)
+// setupEngines creates the engines with the data and the prelude scripts loaded.
+func setupEngines(data map[string]any, opts options) (*engine.MultiEngine, error) {
+	engines, err := newEngines(opts)
 	if err != nil {
-		log.Panicln(err)
+		return nil, err
 	}
-	defer file.Close()
-	err = render.Render(file, engines)
+	if err := engines.InitData(data); err != nil {
+		return nil, err
+	}
+	for _, prelude := range opts.Preludes {
+		if err := engines.LoadPrelude(prelude); err != nil {
+			return nil, err
+		}
+	}
+	return engines, nil
+}
+
+// errorTable formats the errors of the cells as a table.
+func errorTable(err error) (string, bool) {
+	var errs render.RenderErrors
+	if errors.As(err, &errs) {
+		return errs.Table(), true
+	}
+	var cellErr *render.RenderError
+	if errors.As(err, &cellErr) {
+		return render.RenderErrors{cellErr}.Table(), true
+	}
+	return "", false
+}
+
+func renderFile(path string, outPath string, engines render.RenderEngine, opts render.Options) error {
+	file, err := excelize.OpenFile(path)
 	if err != nil {
-		log.Panicln(err)
+		return err
+	}
+	defer file.Close()
+	err = render.RenderWithOptions(file, engines, opts)
+	var errs render.RenderErrors
+	if opts.Policy == render.ErrorPolicy_Lenient && errors.As(err, &errs) &&
+		!errors.Is(err, render.ErrBudgetExceeded) && !errors.Is(err, render.ErrMemoryExceeded) {
+		// the failed cells are marked in the output
+		fmt.Fprint(os.Stderr, errs.Table())
+		log.Printf("[warning] %d cell(s) failed\n", len(errs))
+		err = nil
 	}
-	err = file.SaveAs(*outPath)
 	if err != nil {
-		log.Panicln(err)
+		return err
 	}
-	log.Println("[finish]")
+	return file.SaveAs(outPath)
 }
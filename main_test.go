@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestErrorTable(t *testing.T) {
+	cellErr := &render.RenderError{Sheet: "Sheet1", Cell: "A1", Err: errors.New("bad")}
+	if table, ok := errorTable(fmt.Errorf("out.xlsx: %w", cellErr)); !ok || table != (render.RenderErrors{cellErr}).Table() {
+		t.Errorf("errorTable of a cell error = %q, %v", table, ok)
+	}
+	errs := render.RenderErrors{cellErr, cellErr}
+	if table, ok := errorTable(errs); !ok || table != errs.Table() {
+		t.Errorf("errorTable of the errors = %q, %v", table, ok)
+	}
+	if _, ok := errorTable(errors.New("plain")); ok {
+		t.Error("errorTable of a plain error")
+	}
+}
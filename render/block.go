@@ -0,0 +1,130 @@
+package render
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrUnclosedBlock = errors.New("unclosed each block")
+var ErrUnexpectedBlockEnd = errors.New("unexpected end of each block")
+
+// EachBlock is the `{{#each [lang] exp as name}}` marker, the rows between it
+// and the `{{/each}}` marker are repeated once per element with `name` bound.
+type EachBlock struct {
+	Name string
+	Code string
+}
+
+var eachRegExp = regexp.MustCompile(`^\{\{#each\s+(?P<exp>.+)\s+as\s+(?P<name>\w+)\s*\}\}$`)
+var endEachRegExp = regexp.MustCompile(`^\{\{\s*/each\s*\}\}$`)
+
+func TryParseEachBlock(value string) *EachBlock {
+	value = strings.TrimSpace(value)
+	if !eachRegExp.MatchString(value) {
+		return nil
+	}
+	match := eachRegExp.FindStringSubmatch(value)
+	return &EachBlock{
+		Name: match[eachRegExp.SubexpIndex("name")],
+		Code: match[eachRegExp.SubexpIndex("exp")],
+	}
+}
+
+func IsEachBlockEnd(value string) bool {
+	return endEachRegExp.MatchString(strings.TrimSpace(value))
+}
+
+type blockScope struct {
+	Top    int
+	Bottom int
+	Name   string
+	Value  any
+}
+
+func getCellText(workbook *excelize.File, sheet string, cellName string) (string, bool) {
+	cellType, _ := workbook.GetCellType(sheet, cellName)
+	if cellType != excelize.CellTypeInlineString && cellType != excelize.CellTypeSharedString {
+		return "", false
+	}
+	value, _ := workbook.GetCellValue(sheet, cellName)
+	return value, true
+}
+
+// findBlockEnd returns the row of the `{{/each}}` marker matching the block
+// started at row.
+func findBlockEnd(workbook *excelize.File, sheet string, area *Area, row int) (int, error) {
+	depth := 0
+	for currentRow := row + 1; currentRow <= area.Bottom; currentRow += 1 {
+		for currentCol := area.Left; currentCol <= area.Right; currentCol += 1 {
+			cellName, _ := excelize.CoordinatesToCellName(currentCol, currentRow)
+			value, ok := getCellText(workbook, sheet, cellName)
+			if !ok {
+				continue
+			}
+			if TryParseEachBlock(value) != nil {
+				depth += 1
+				break
+			}
+			if IsEachBlockEnd(value) {
+				if depth == 0 {
+					return currentRow, nil
+				}
+				depth -= 1
+				break
+			}
+		}
+	}
+	return 0, ErrUnclosedBlock
+}
+
+// expandBlock repeats the rows between the start and end marker rows count
+// times, with styles, row heights and merged cells, and removes both markers.
+func expandBlock(workbook *excelize.File, sheet string, start int, end int, count int) error {
+	if count == 0 {
+		for row := end; row >= start; row-- {
+			if err := workbook.RemoveRow(sheet, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := workbook.RemoveRow(sheet, end); err != nil {
+		return err
+	}
+
+	height := end - start - 1
+	mergeCells, err := workbook.GetMergeCells(sheet)
+	if err != nil {
+		return err
+	}
+	// merged cells in a single row are copied by DuplicateRowTo
+	multiRowMerges := []*Area{}
+	for _, mCell := range mergeCells {
+		mArea, err := NewArea(mCell.GetStartAxis() + ":" + mCell.GetEndAxis())
+		if err != nil {
+			return err
+		}
+		if mArea.Top > start && mArea.Bottom < end && mArea.Top != mArea.Bottom {
+			multiRowMerges = append(multiRowMerges, mArea)
+		}
+	}
+
+	for i := 1; i < count; i++ {
+		for r := 0; r < height; r++ {
+			if err := workbook.DuplicateRowTo(sheet, start+1+r, start+1+i*height+r); err != nil {
+				return err
+			}
+		}
+		for _, mArea := range multiRowMerges {
+			from, _ := excelize.CoordinatesToCellName(mArea.Left, mArea.Top+i*height)
+			to, _ := excelize.CoordinatesToCellName(mArea.Right, mArea.Bottom+i*height)
+			if err := workbook.MergeCell(sheet, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return workbook.RemoveRow(sheet, start)
+}
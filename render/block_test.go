@@ -0,0 +1,106 @@
+package render_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestParseEachBlock(t *testing.T) {
+	block := render.TryParseEachBlock(" {{#each [js] data.items as item}} ")
+	if block == nil || block.Name != "item" || block.Code != "[js] data.items" {
+		t.Errorf("TryParseEachBlock = %+v", block)
+	}
+	if block := render.TryParseEachBlock("{{#each [js] data.items}}"); block != nil {
+		t.Errorf("TryParseEachBlock without name = %+v, want nil", block)
+	}
+	if !render.IsEachBlockEnd("{{ /each }}") || render.IsEachBlockEnd("{{/if}}") {
+		t.Error("IsEachBlockEnd")
+	}
+}
+
+func TestEachBlock(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "head",
+		"A2": "{{#each [js] data.items as item}}",
+		"A3": "{{[js] item.name}}",
+		"B3": "{{[py] item['qty'] * 2}}",
+		"A4": "-",
+		"A5": "{{/each}}",
+		"A6": "tail",
+	}, map[string]any{"data": map[string]any{"items": []any{
+		map[string]any{"name": "a", "qty": 1},
+		map[string]any{"name": "b", "qty": 2},
+	}}})
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"A1": "head",
+		"A2": "a", "B2": "2",
+		"A3": "-",
+		"A4": "b", "B4": "4",
+		"A5": "-",
+		"A6": "tail",
+	})
+}
+
+func TestEachBlockNested(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{#each [js] [[1, 2], [3]] as item}}",
+		"A2": "{{#each [js] item as item}}",
+		"A3": "{{[js] item}}",
+		"A4": "{{/each}}",
+		"A5": "{{[js] JSON.stringify(item)}}",
+		"A6": "{{/each}}",
+		"A7": "{{[js] typeof item}}",
+		"B7": `{{[py] "item" in globals()}}`,
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"A1": "1",
+		"A2": "2",
+		"A3": "[1,2]",
+		"A4": "3",
+		"A5": "[3]",
+		"A6": "undefined",
+		"B6": "FALSE",
+	})
+}
+
+func TestEachBlockEmpty(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{#each [js] [] as item}}",
+		"A2": "{{[js] item}}",
+		"A3": "{{/each}}",
+		"A4": "tail",
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{"A1": "tail", "A2": ""})
+}
+
+func TestEachBlockUnclosed(t *testing.T) {
+	_, err := renderCells(t, map[string]string{
+		"A1": "{{#each [js] [1] as item}}",
+		"A2": "{{[js] item}}",
+	}, nil, render.Options{})
+	if !errors.Is(err, render.ErrUnclosedBlock) {
+		t.Errorf("error = %v, want %v", err, render.ErrUnclosedBlock)
+	}
+	_, err = renderCells(t, map[string]string{"A1": "{{/each}}"}, nil, render.Options{})
+	if !errors.Is(err, render.ErrUnexpectedBlockEnd) {
+		t.Errorf("error = %v, want %v", err, render.ErrUnexpectedBlockEnd)
+	}
+}
+
+func TestIfBlock(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{if [js] data.vip}}",
+		"D1": "vip",
+		"A2": "{{if [py] data['discount'] > 0}}",
+		"D2": "discount",
+		"B3": "{{if col [cel] data.data.vip}}",
+		"C3": "{{if col [js] !data.vip}}",
+		"D3": "last",
+	}, map[string]any{"data": map[string]any{"vip": true, "discount": 0}})
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"A1": "", "C1": "vip",
+		"B2": "", "C2": "last",
+	})
+}
@@ -0,0 +1,146 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrUnknownArea = errors.New("unknown named area")
+
+var chartTypeName = map[string]excelize.ChartType{
+	"area":     excelize.Area,
+	"bar":      excelize.Bar,
+	"col":      excelize.Col,
+	"column":   excelize.Col,
+	"line":     excelize.Line,
+	"pie":      excelize.Pie,
+	"doughnut": excelize.Doughnut,
+	"radar":    excelize.Radar,
+	"scatter":  excelize.Scatter,
+}
+
+// ChartBlock is the `{{chart(type=line, data=@sales, title="Revenue")}}`
+// marker, a chart anchored at its cell over the final range of a named area.
+// Data and categories are either `@name` or a range of the sheet.
+type ChartBlock struct {
+	Type       excelize.ChartType
+	Data       string
+	Categories string
+	Title      string
+}
+
+var chartRegExp = regexp.MustCompile(`^\{\{\s*chart\((?P<args>.*)\)\s*\}\}$`)
+
+func TryParseChartBlock(value string) *ChartBlock {
+	value = strings.TrimSpace(value)
+	if !chartRegExp.MatchString(value) {
+		return nil
+	}
+	match := chartRegExp.FindStringSubmatch(value)
+	ret := &ChartBlock{Type: excelize.Line}
+	for _, arg := range splitFormat(match[chartRegExp.SubexpIndex("args")], ',') {
+		arg = strings.TrimSpace(arg)
+		if !formatOptionRegExp.MatchString(arg) {
+			return nil
+		}
+		argMatch := formatOptionRegExp.FindStringSubmatch(arg)
+		value := unquoteOption(strings.TrimSpace(argMatch[formatOptionRegExp.SubexpIndex("value")]))
+		switch argMatch[formatOptionRegExp.SubexpIndex("key")] {
+		case "type":
+			chartType, ok := chartTypeName[value]
+			if !ok {
+				return nil
+			}
+			ret.Type = chartType
+		case "data":
+			ret.Data = value
+		case "categories":
+			ret.Categories = value
+		case "title":
+			ret.Title = value
+		default:
+			return nil
+		}
+	}
+	if ret.Data == "" {
+		return nil
+	}
+	return ret
+}
+
+func quoteSheetName(sheet string) string {
+	return "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+}
+
+func absoluteRange(sheet string, left int, top int, right int, bottom int) string {
+	from := cellRef{Col: left, Row: top, AbsCol: true, AbsRow: true}
+	to := cellRef{Col: right, Row: bottom, AbsCol: true, AbsRow: true}
+	return quoteSheetName(sheet) + "!" + from.String() + ":" + to.String()
+}
+
+// resolveArea returns the named area of `@name`, or the range on the sheet.
+func resolveArea(value string, sheet string, names map[string]*namedArea) (*namedArea, error) {
+	if strings.HasPrefix(value, "@") {
+		named, ok := names[value[1:]]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownArea, value[1:])
+		}
+		return named, nil
+	}
+	ref := refMatch{}
+	replaceRefs(value, func(match *refMatch) bool {
+		ref = *match
+		return false
+	})
+	if ref.From == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownArea, value)
+	}
+	if ref.Sheet == "" {
+		ref.Sheet = sheet
+	}
+	if ref.To == nil {
+		ref.To = ref.From
+	}
+	return &namedArea{Sheet: ref.Sheet, Area: &Area{Left: ref.From.Col, Top: ref.From.Row, Right: ref.To.Col, Bottom: ref.To.Row}}, nil
+}
+
+// addChart anchors the chart at the cell. A single row of data is one series,
+// otherwise each column is a series.
+func addChart(workbook *excelize.File, sheet string, cellName string, block *ChartBlock, names map[string]*namedArea) error {
+	data, err := resolveArea(block.Data, sheet, names)
+	if err != nil {
+		return err
+	}
+	categories := ""
+	if block.Categories != "" {
+		named, err := resolveArea(block.Categories, sheet, names)
+		if err != nil {
+			return err
+		}
+		categories = absoluteRange(named.Sheet, named.Area.Left, named.Area.Top, named.Area.Right, named.Area.Bottom)
+	}
+
+	chart := &excelize.Chart{Type: block.Type}
+	if block.Title != "" {
+		chart.Title = []excelize.RichTextRun{{Text: block.Title}}
+	}
+	area := data.Area
+	if area.Top == area.Bottom {
+		chart.Series = append(chart.Series, excelize.ChartSeries{
+			Categories: categories,
+			Values:     absoluteRange(data.Sheet, area.Left, area.Top, area.Right, area.Bottom),
+		})
+	} else {
+		for col := area.Left; col <= area.Right; col += 1 {
+			chart.Series = append(chart.Series, excelize.ChartSeries{
+				Categories: categories,
+				Values:     absoluteRange(data.Sheet, col, area.Top, col, area.Bottom),
+			})
+		}
+	}
+	return workbook.AddChart(sheet, cellName, chart)
+}
@@ -0,0 +1,48 @@
+package render
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseChartBlock(t *testing.T) {
+	tests := []struct {
+		value string
+		want  *ChartBlock
+	}{
+		{`{{chart(type=bar, data=@sales, categories=@months, title="Revenue, 2024")}}`, &ChartBlock{Type: excelize.Bar, Data: "@sales", Categories: "@months", Title: "Revenue, 2024"}},
+		{`{{ chart(data=B2:B5) }}`, &ChartBlock{Type: excelize.Line, Data: "B2:B5"}},
+		{`{{chart(type=bar)}}`, nil},
+		{`{{chart(type=funnel, data=@x)}}`, nil},
+		{`{{chart(data=@x, color=red)}}`, nil},
+	}
+	for _, test := range tests {
+		if got := TryParseChartBlock(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("TryParseChartBlock(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestResolveArea(t *testing.T) {
+	names := map[string]*namedArea{"sales": {Sheet: "Data", Area: &Area{Left: 2, Top: 2, Right: 2, Bottom: 9}}}
+	tests := []struct {
+		value string
+		want  *namedArea
+		err   error
+	}{
+		{"@sales", names["sales"], nil},
+		{"B2:C4", &namedArea{Sheet: "Sheet1", Area: &Area{Left: 2, Top: 2, Right: 3, Bottom: 4}}, nil},
+		{"'My Sheet'!A1", &namedArea{Sheet: "My Sheet", Area: &Area{Left: 1, Top: 1, Right: 1, Bottom: 1}}, nil},
+		{"@missing", nil, ErrUnknownArea},
+		{"nothing", nil, ErrUnknownArea},
+	}
+	for _, test := range tests {
+		got, err := resolveArea(test.value, "Sheet1", names)
+		if !errors.Is(err, test.err) || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("resolveArea(%q) = %+v, %v, want %+v, %v", test.value, got, err, test.want, test.err)
+		}
+	}
+}
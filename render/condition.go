@@ -0,0 +1,62 @@
+package render
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	IfTarget_Row int = iota
+	IfTarget_Col
+)
+
+var IfTargetName = map[string]int{
+	"":    IfTarget_Row,
+	"row": IfTarget_Row,
+	"col": IfTarget_Col,
+}
+
+// IfBlock is the `{{if [row|col] [lang] exp}}` marker, the row or column
+// holding it is removed when the expression is falsy.
+type IfBlock struct {
+	Target int
+	Code   string
+}
+
+var ifRegExp = regexp.MustCompile(`^\{\{if(\s+(?P<target>row|col))?\s+(?P<exp>.+)\}\}$`)
+
+func TryParseIfBlock(value string) *IfBlock {
+	value = strings.TrimSpace(value)
+	if !ifRegExp.MatchString(value) {
+		return nil
+	}
+	match := ifRegExp.FindStringSubmatch(value)
+	return &IfBlock{
+		Target: IfTargetName[match[ifRegExp.SubexpIndex("target")]],
+		Code:   match[ifRegExp.SubexpIndex("exp")],
+	}
+}
+
+func isTruthy(value any) bool {
+	switch val := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case string:
+		return val != ""
+	}
+	ref := reflect.ValueOf(value)
+	switch ref.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return ref.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ref.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ref.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return ref.Float() != 0 && ref.Float() == ref.Float()
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package render
+
+import "testing"
+
+func TestParseIfBlock(t *testing.T) {
+	tests := []struct {
+		value string
+		want  *IfBlock
+	}{
+		{"{{if [js] data.vip}}", &IfBlock{Target: IfTarget_Row, Code: "[js] data.vip"}},
+		{"{{if row [js] data.vip}}", &IfBlock{Target: IfTarget_Row, Code: "[js] data.vip"}},
+		{" {{if col [py] vip}} ", &IfBlock{Target: IfTarget_Col, Code: "[py] vip"}},
+		{"{{iffy}}", nil},
+	}
+	for _, test := range tests {
+		got := TryParseIfBlock(test.value)
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("TryParseIfBlock(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestIsTruthy(t *testing.T) {
+	tests := []struct {
+		value any
+		want  bool
+	}{
+		{nil, false},
+		{false, false},
+		{true, true},
+		{0, false},
+		{0.0, false},
+		{int64(3), true},
+		{"", false},
+		{"no", true},
+		{[]any{}, false},
+		{[]any{0}, true},
+		{map[string]any{}, false},
+		{map[string]any{"a": 1}, true},
+	}
+	for _, test := range tests {
+		if got := isTruthy(test.value); got != test.want {
+			t.Errorf("isTruthy(%#v) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package render
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ConfigSheet is the reserved sheet evaluated before the others and removed
+// from the output. Each row is either a script in column A, such as
+// `[js] function fmt(v) { ... }`, or a variable with its name in column A and
+// its value in column B, which is a literal or an expression.
+const ConfigSheet = "_flow"
+
+var scriptRegExp = regexp.MustCompile(`^\[\w+\]`)
+
+func getConfigValue(workbook *excelize.File, cellName string) any {
+	cellType, _ := workbook.GetCellType(ConfigSheet, cellName)
+	value, _ := workbook.GetCellValue(ConfigSheet, cellName, excelize.Options{RawCellValue: true})
+	switch cellType {
+	case excelize.CellTypeBool:
+		return value == "1"
+	case excelize.CellTypeInlineString, excelize.CellTypeSharedString, excelize.CellTypeFormula:
+		return value
+	}
+	if ret, err := strconv.ParseFloat(value, 64); err == nil {
+		return ret
+	}
+	return value
+}
+
+// renderConfig runs the rows of the config sheet in order and deletes it.
+func renderConfig(workbook *excelize.File, engine RenderEngine, state *renderState) error {
+	if index, _ := workbook.GetSheetIndex(ConfigSheet); index == -1 {
+		return nil
+	}
+	rows, err := workbook.GetRows(ConfigSheet)
+	if err != nil {
+		return err
+	}
+	for r, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		key := strings.TrimSpace(row[0])
+		cellName, _ := excelize.CoordinatesToCellName(1, r+1)
+		if err := state.prepare(engine); err != nil {
+			return state.fail(newRenderError(ConfigSheet, cellName, row[0], "", err))
+		}
+		if scriptRegExp.MatchString(key) {
+			if err := engine.Exec(key); err != nil {
+				if err := state.fail(newRenderError(ConfigSheet, cellName, row[0], key, err)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if key == "" || len(row) < 2 || strings.TrimSpace(row[1]) == "" {
+			continue
+		}
+		cellName, _ = excelize.CoordinatesToCellName(2, r+1)
+		value := getConfigValue(workbook, cellName)
+		if code, ok := value.(string); ok && scriptRegExp.MatchString(strings.TrimSpace(code)) {
+			if value, err = engine.Eval(strings.TrimSpace(code)); err != nil {
+				if err := state.fail(newRenderError(ConfigSheet, cellName, code, code, err)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := engine.SetData(key, value); err != nil {
+			return err
+		}
+	}
+	return workbook.DeleteSheet(ConfigSheet)
+}
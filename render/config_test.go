@@ -0,0 +1,67 @@
+package render_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestConfigSheet(t *testing.T) {
+	workbook := newWorkbook(t, map[string]string{
+		"A1": `{{[js] label(rate * 2)}}`,
+		"B1": `{{[py] double(len(regions))}}`,
+		"C1": `{{[cel] enabled && title == "Sales"}}`,
+	})
+	if _, err := workbook.NewSheet(render.ConfigSheet); err != nil {
+		t.Fatal(err)
+	}
+	for cellName, value := range map[string]any{
+		"A1": `[js] function label(n) { return "Q" + n }`,
+		"A2": "[py] def double(x): return x * 2",
+		"A3": "rate", "B3": 1.5,
+		"A4": "enabled", "B4": true,
+		"A5": "title", "B5": "Sales",
+		"A6": "regions", "B6": "[js] data.regions.map(r => r.name)",
+		"A7": "ignored",
+	} {
+		if err := workbook.SetCellValue(render.ConfigSheet, cellName, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engines := newEngines(t)
+	err := engines.InitData(map[string]any{"data": map[string]any{"regions": []any{
+		map[string]any{"name": "North"}, map[string]any{"name": "South"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := render.Render(workbook, engines); err != nil {
+		t.Fatal(err)
+	}
+	if index, _ := workbook.GetSheetIndex(render.ConfigSheet); index != -1 {
+		t.Error("the config sheet is not removed")
+	}
+	expectCells(t, workbook, "Sheet1", map[string]string{"A1": "Q3", "B1": "4", "C1": "TRUE"})
+}
+
+func TestConfigSheetError(t *testing.T) {
+	workbook := newWorkbook(t, map[string]string{"A1": "x"})
+	if _, err := workbook.NewSheet(render.ConfigSheet); err != nil {
+		t.Fatal(err)
+	}
+	if err := workbook.SetCellValue(render.ConfigSheet, "A1", "total"); err != nil {
+		t.Fatal(err)
+	}
+	if err := workbook.SetCellValue(render.ConfigSheet, "B1", "[js] missing.value"); err != nil {
+		t.Fatal(err)
+	}
+	err := render.Render(workbook, newEngines(t))
+	var renderErr *render.RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("error = %v, want a RenderError", err)
+	}
+	if renderErr.Sheet != render.ConfigSheet || renderErr.Cell != "B1" || renderErr.Engine != "js" {
+		t.Errorf("error at %s!%s [%s], want %s!B1 [js]", renderErr.Sheet, renderErr.Cell, renderErr.Engine, render.ConfigSheet)
+	}
+}
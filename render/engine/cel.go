@@ -1,20 +1,35 @@
 package engine
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"reflect"
 	"regexp"
+	"time"
 
 	"github.com/azurity/flow-table/render"
 	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
 	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type CelEngine struct {
-	env  *cel.Env
-	data map[string]any
+	env       *cel.Env
+	data      map[string]any
+	vars      map[string]any
+	deadline  time.Time
+	costLimit uint64
 }
 
+// celInterruptFrequency is how many comprehension iterations run between the
+// checks of the deadline.
+const celInterruptFrequency = 100
+
 var jsonRegExp = regexp.MustCompile(`(^|\b)json:"(.+)"($|\b)`)
 
 func fieldJsonName(t reflect.StructField) string {
@@ -26,6 +41,9 @@ func fieldJsonName(t reflect.StructField) string {
 }
 
 func struct2Map(obj reflect.Value) any {
+	if !obj.IsValid() {
+		return nil
+	}
 	t := obj.Type()
 
 	switch t.Kind() {
@@ -57,7 +75,7 @@ func struct2Map(obj reflect.Value) any {
 	case reflect.Pointer:
 		return struct2Map(obj.Elem())
 	default:
-		return obj.Addr().Interface()
+		return obj.Interface()
 	}
 }
 
@@ -70,7 +88,8 @@ func NewCelEngine() (*CelEngine, error) {
 		return nil, err
 	}
 	return &CelEngine{
-		env: env,
+		env:  env,
+		vars: map[string]any{},
 	}, nil
 }
 
@@ -79,20 +98,156 @@ func (engine *CelEngine) InitData(data map[string]any) error {
 	return nil
 }
 
-func (engine *CelEngine) CalcValue(formula *render.FlowFormula) (data [][]any, rows int, cols int, err error) {
-	ast, issue := engine.env.Compile(formula.Code)
+func (engine *CelEngine) SetData(name string, value any) error {
+	value, err := normalizeValue(value)
+	if err != nil {
+		return err
+	}
+	if _, ok := engine.vars[name]; !ok {
+		env, err := engine.env.Extend(cel.Variable(name, cel.DynType))
+		if err != nil {
+			return err
+		}
+		engine.env = env
+	}
+	engine.vars[name] = value
+	return nil
+}
+
+// UnsetData leaves the variable declared, so the code reading it fails at
+// evaluation.
+func (engine *CelEngine) UnsetData(name string) error {
+	delete(engine.vars, name)
+	return nil
+}
+
+// issueError locates the first issue of the compilation.
+func issueError(issue *cel.Issues) error {
+	if errs := issue.Errors(); len(errs) > 0 && errs[0].Location.Line() > 0 {
+		// the column of cel starts at 0
+		return &render.ExprError{Line: errs[0].Location.Line(), Column: errs[0].Location.Column() + 1, Err: errors.New(errs[0].Message)}
+	}
+	return issue.Err()
+}
+
+func (engine *CelEngine) eval(code string) (ref.Val, error) {
+	ast, issue := engine.env.Compile(code)
 	if issue.Err() != nil {
-		return nil, 0, 0, issue.Err()
+		return nil, issueError(issue)
+	}
+	opts := []cel.ProgramOption{cel.InterruptCheckFrequency(celInterruptFrequency)}
+	if engine.costLimit > 0 {
+		opts = append(opts, cel.CostLimit(engine.costLimit))
 	}
-	program, err := engine.env.Program(ast)
+	program, err := engine.env.Program(ast, opts...)
 	if err != nil {
-		return nil, 0, 0, issue.Err()
+		return nil, err
 	}
-	value, _, err := program.Eval(map[string]any{
+	activation := map[string]any{
 		"data": engine.data,
-	})
+	}
+	for name, value := range engine.vars {
+		activation[name] = value
+	}
+	ctx := context.Background()
+	if !engine.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, engine.deadline)
+		defer cancel()
+	}
+	value, _, err := program.ContextEval(ctx, activation)
+	if err != nil && ctx.Err() != nil {
+		return nil, render.ErrTimeout
+	}
 	if err != nil {
 		log.Println(err)
+		return nil, err
+	}
+	return value, nil
+}
+
+// EnableSandbox does nothing, as cel has no access to files, OS, time or
+// random source, and no dynamic code.
+func (engine *CelEngine) EnableSandbox(opts SandboxOptions) error {
+	return nil
+}
+
+func (engine *CelEngine) SetDeadline(deadline time.Time) {
+	engine.deadline = deadline
+}
+
+// SetCostLimit limits the estimated cost of each evaluation, 0 for no limit.
+func (engine *CelEngine) SetCostLimit(limit uint64) {
+	engine.costLimit = limit
+}
+
+func (engine *CelEngine) export(value ref.Val) (any, error) {
+	ret, err := value.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, err
+	}
+	return ret.(*structpb.Value).AsInterface(), nil
+}
+
+func (engine *CelEngine) Eval(code string) (any, error) {
+	value, err := engine.eval(code)
+	if err != nil {
+		return nil, err
+	}
+	return engine.export(value)
+}
+
+// Check parses the code, the names read are its variables and the fields of data.
+func (engine *CelEngine) Check(code string, script bool) (*render.CodeInfo, error) {
+	parsed, issue := engine.env.Parse(code)
+	if issue.Err() != nil {
+		return nil, issueError(issue)
+	}
+	tree := parsed.NativeRep()
+	idents := []celast.Expr{}
+	locals := map[string]bool{"data": true}
+	celast.PreOrderVisit(tree.Expr(), celast.NewExprVisitor(func(expr celast.Expr) {
+		switch expr.Kind() {
+		case celast.IdentKind:
+			idents = append(idents, expr)
+		case celast.SelectKind:
+			if operand := expr.AsSelect().Operand(); operand.Kind() == celast.IdentKind && operand.AsIdent() == "data" {
+				idents = append(idents, expr)
+			}
+		case celast.ComprehensionKind:
+			locals[expr.AsComprehension().IterVar()] = true
+			locals[expr.AsComprehension().AccuVar()] = true
+		}
+	}))
+
+	ret := &render.CodeInfo{}
+	seen := map[string]bool{}
+	for _, expr := range idents {
+		name := ""
+		if expr.Kind() == celast.SelectKind {
+			name = expr.AsSelect().FieldName()
+		} else if name = expr.AsIdent(); locals[name] {
+			continue
+		}
+		if _, ok := engine.vars[name]; ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		location := tree.SourceInfo().GetStartLocation(expr.ID())
+		ret.Refs = append(ret.Refs, render.CodeName{Name: name, Line: location.Line(), Column: location.Column() + 1})
+	}
+	return ret, nil
+}
+
+// Exec evaluates the code and drops the result, as cel has no statements.
+func (engine *CelEngine) Exec(code string) error {
+	_, err := engine.eval(code)
+	return err
+}
+
+func (engine *CelEngine) CalcValue(formula *render.FlowFormula) (data [][]any, rows int, cols int, err error) {
+	value, err := engine.eval(formula.Code)
+	if err != nil {
 		return nil, 0, 0, err
 	}
 
@@ -102,7 +257,7 @@ func (engine *CelEngine) CalcValue(formula *render.FlowFormula) (data [][]any, r
 		if err != nil {
 			return nil, 0, 0, err
 		}
-		data = val.([][]any)
+		data = tableValue(val.([]any))
 		if len(data) == 0 {
 			data = append(data, []any{})
 		}
@@ -150,25 +305,85 @@ func (engine *CelEngine) CalcValue(formula *render.FlowFormula) (data [][]any, r
 func (engine *CelEngine) extractValue(value ref.Val, level int, class string) (any, error) {
 	var elemType reflect.Type
 	switch class {
-	case render.FlowFormulaFormat_String:
+	case render.FlowFormulaFormat_String, render.FlowFormulaFormat_Formula:
 		elemType = reflect.TypeOf("")
 	case render.FlowFormulaFormat_Int:
 		elemType = reflect.TypeOf(int(0))
+	case render.FlowFormulaFormat_Date, render.FlowFormulaFormat_Time, render.FlowFormulaFormat_DateTime:
+		elemType = reflect.TypeOf(time.Time{})
 	default:
 		elemType = reflect.TypeOf(float64(0))
 	}
 	if level == 0 {
+		if mapper, ok := value.(traits.Mapper); ok {
+			inner, hasValue := mapper.Find(types.String("value"))
+			style, hasStyle := mapper.Find(types.String("style"))
+			if hasValue && hasStyle {
+				val, err := engine.extractValue(inner, 0, class)
+				if err != nil {
+					return nil, err
+				}
+				styleValue, err := engine.export(style)
+				if err != nil {
+					return nil, err
+				}
+				styleMap, _ := styleValue.(map[string]any)
+				return render.FlowStyledValue{Value: val, Style: styleMap}, nil
+			}
+		}
+		if class == render.FlowFormulaFormat_Auto {
+			switch val := value.(type) {
+			case types.Null:
+				return nil, nil
+			case types.Bool:
+				return bool(val), nil
+			case types.String:
+				return string(val), nil
+			case types.Int:
+				return float64(val), nil
+			case types.Uint:
+				return float64(val), nil
+			case types.Double:
+				return float64(val), nil
+			}
+			return fmt.Sprint(value.Value()), nil
+		}
+		if class == render.FlowFormulaFormat_Link {
+			val, err := engine.export(value)
+			if err != nil {
+				return nil, err
+			}
+			return linkValue(val), nil
+		}
+		if class == render.FlowFormulaFormat_Image {
+			switch val := value.(type) {
+			case types.String:
+				return string(val), nil
+			case types.Bytes:
+				return []byte(val), nil
+			}
+			return nil, nil
+		}
+		if str, ok := value.(types.String); ok && elemType == reflect.TypeOf(time.Time{}) {
+			if ret, ok := parseTime(string(str)); ok {
+				return ret, nil
+			}
+			return nil, nil
+		}
 		return value.ConvertToNative(elemType)
 	} else {
-		retType := elemType
-		for i := 0; i < level; i++ {
-			retType = reflect.TypeOf(retType)
-		}
-		ret, err := value.ConvertToNative(retType)
-		if err == nil {
+		if list, ok := value.(traits.Lister); ok {
+			ret := []any{}
+			for it := list.Iterator(); it.HasNext() == types.True; {
+				item, err := engine.extractValue(it.Next(), level-1, class)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, item)
+			}
 			return ret, nil
 		}
-		ret, err = engine.extractValue(value, level-1, class)
+		ret, err := engine.extractValue(value, level-1, class)
 		if err == nil {
 			return []any{ret}, nil
 		}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestCelTimeout(t *testing.T) {
+	engine, err := NewCelEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetDeadline(time.Now().Add(-time.Second))
+	// the interrupt is checked every few iterations of the comprehensions
+	list := "[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20]"
+	if _, err := engine.Eval(list + ".map(x, " + list + ".map(y, x * y))"); !errors.Is(err, render.ErrTimeout) {
+		t.Errorf("error = %v, want %v", err, render.ErrTimeout)
+	}
+}
+
+func TestCelCostLimit(t *testing.T) {
+	engine, err := NewCelEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetCostLimit(10)
+	if _, err := engine.Eval("[1, 2, 3, 4, 5, 6, 7, 8].map(x, [1, 2, 3, 4].map(y, x * y))"); err == nil {
+		t.Error("Eval over the cost limit succeeded")
+	}
+	engine.SetCostLimit(0)
+	if _, err := engine.Eval("[1, 2, 3, 4, 5, 6, 7, 8].map(x, [1, 2, 3, 4].map(y, x * y))"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCelCheck(t *testing.T) {
+	engine, err := NewCelEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.SetData("bound", 1); err != nil {
+		t.Fatal(err)
+	}
+	info, err := engine.Check("data.items.map(x, x * rate).size() + bound + data.total", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refNames(info); !reflect.DeepEqual(got, []string{"items", "rate", "total"}) {
+		t.Errorf("refs = %v", got)
+	}
+	if ref := info.Refs[1]; ref.Line != 1 || ref.Column != 23 {
+		t.Errorf("rate at %d:%d, want 1:23", ref.Line, ref.Column)
+	}
+
+	_, err = engine.Check("1 +", false)
+	var exprErr *render.ExprError
+	if !errors.As(err, &exprErr) || exprErr.Line != 1 || exprErr.Column != 4 {
+		t.Errorf("error = %v, want a syntax error at 1:4", err)
+	}
+}
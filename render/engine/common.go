@@ -1,18 +1,84 @@
 package engine
 
 import (
+	"encoding/json"
 	"math"
+	"time"
 
 	"github.com/azurity/flow-table/render"
 )
 
 func paddingValue(class string) any {
 	switch class {
-	case render.FlowFormulaFormat_String:
+	case render.FlowFormulaFormat_String, render.FlowFormulaFormat_Formula:
 		return ""
 	case render.FlowFormulaFormat_Int:
 		return int(0)
+	case render.FlowFormulaFormat_Auto, render.FlowFormulaFormat_Link, render.FlowFormulaFormat_Image, render.FlowFormulaFormat_Date, render.FlowFormulaFormat_Time, render.FlowFormulaFormat_DateTime:
+		return nil
 	default:
 		return math.NaN()
 	}
 }
+
+func tableValue(value []any) [][]any {
+	ret := [][]any{}
+	for _, row := range value {
+		ret = append(ret, row.([]any))
+	}
+	return ret
+}
+
+// normalizeValue converts the value into the json-like form (nil, bool,
+// float64, string, []any, map[string]any) shared by all engines.
+func normalizeValue(value any) (any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var ret any
+	err = json.Unmarshal(raw, &ret)
+	return ret, err
+}
+
+// linkValue converts a string or an object with `url`, `text` and `tooltip`
+// into render.FlowLink, the value should be normalized.
+func linkValue(value any) any {
+	switch val := value.(type) {
+	case string:
+		return render.FlowLink{URL: val, Text: val}
+	case map[string]any:
+		link := render.FlowLink{}
+		link.URL, _ = val["url"].(string)
+		link.Text, _ = val["text"].(string)
+		link.Tooltip, _ = val["tooltip"].(string)
+		if link.Text == "" {
+			link.Text = link.URL
+		}
+		return link
+	}
+	return nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"15:04:05",
+	"15:04",
+}
+
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if ret, err := time.Parse(layout, value); err == nil {
+			return ret, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -2,47 +2,367 @@ package engine
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"math"
+	"math/rand"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/azurity/flow-table/render"
 	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+	"github.com/dop251/goja_nodejs/console"
+	"github.com/dop251/goja_nodejs/require"
 )
 
 type JsEngine struct {
-	vm *goja.Runtime
+	vm        *goja.Runtime
+	parseJSON goja.Callable
+	deadline  time.Time
+}
+
+// logPrinter forwards `console.log` to the logger.
+type logPrinter struct{}
+
+func (logPrinter) Log(msg string) {
+	log.Printf("[console] %s\n", msg)
+}
+
+func (logPrinter) Warn(msg string) {
+	log.Printf("[console:warn] %s\n", msg)
+}
+
+func (logPrinter) Error(msg string) {
+	log.Printf("[console:error] %s\n", msg)
+}
+
+func noSourceLoader(path string) ([]byte, error) {
+	return nil, require.ModuleFileDoesNotExistError
 }
 
 func NewJsEngine() *JsEngine {
-	return &JsEngine{
-		vm: goja.New(),
+	vm := goja.New()
+	parseJSON, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	engine := &JsEngine{
+		vm:        vm,
+		parseJSON: parseJSON,
 	}
+	engine.enableRegistry(require.NewRegistry(require.WithLoader(noSourceLoader)))
+	return engine
 }
 
-func (engine *JsEngine) InitData(data map[string]any) error {
-	for key, value := range data {
-		data, err := json.Marshal(value)
+func (engine *JsEngine) enableRegistry(registry *require.Registry) {
+	registry.RegisterNativeModule(console.ModuleName, console.RequireWithPrinter(logPrinter{}))
+	registry.Enable(engine.vm)
+	console.Enable(engine.vm)
+}
+
+// EnableRequire enables `require()` of CommonJS modules. Relative paths are
+// resolved from baseDir, and bare module names are also searched in moduleDirs.
+func (engine *JsEngine) EnableRequire(baseDir string, moduleDirs ...string) error {
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	folders := []string{}
+	for _, dir := range moduleDirs {
+		dir, err := filepath.Abs(dir)
 		if err != nil {
 			return err
 		}
-		_, err = engine.vm.RunString(fmt.Sprintf("const %s = %s;", key, string(data)))
-		if err != nil {
+		folders = append(folders, dir)
+	}
+	loader := func(path string) ([]byte, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		return require.DefaultSourceLoader(path)
+	}
+	engine.enableRegistry(require.NewRegistry(require.WithLoader(loader), require.WithGlobalFolders(folders...)))
+	return nil
+}
+
+// InitData binds the data as SetData does, so the variables bound later by
+// the rendering replace them instead of being shadowed.
+func (engine *JsEngine) InitData(data map[string]any) error {
+	for key, value := range data {
+		if err := engine.SetData(key, value); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// sandboxScript removes the dynamic code and freezes the builtin objects. The
+// global object itself is kept extensible for the data.
+const sandboxScript = `(function () {
+	const forbidden = function () { throw new EvalError("dynamic code is not allowed") };
+	for (const fn of [function () {}, function* () {}, async function () {}]) {
+		Object.defineProperty(Object.getPrototypeOf(fn), "constructor", { value: forbidden });
+		Object.freeze(Object.getPrototypeOf(fn));
+	}
+	globalThis.eval = forbidden;
+	globalThis.Function = forbidden;
+	for (const name of Object.getOwnPropertyNames(globalThis)) {
+		const value = globalThis[name];
+		if ((typeof value === "object" || typeof value === "function") && value !== null && value !== globalThis) {
+			Object.freeze(value);
+			if (value.prototype) {
+				Object.freeze(value.prototype);
+			}
+		}
+		Object.defineProperty(globalThis, name, { writable: false, configurable: false });
+	}
+})()`
+
+// EnableSandbox forbids eval and Function, freezes the builtin objects, and
+// makes the clock and random source deterministic. require() is limited to
+// the native modules.
+func (engine *JsEngine) EnableSandbox(opts SandboxOptions) error {
+	clock := opts.clock()
+	engine.vm.SetTimeSource(func() time.Time {
+		return clock
+	})
+	engine.vm.SetRandSource(rand.New(rand.NewSource(opts.Seed)).Float64)
+	engine.enableRegistry(require.NewRegistry(require.WithLoader(noSourceLoader)))
+	_, err := engine.vm.RunString(sandboxScript)
+	return err
+}
+
+// SetData binds the value as plain javascript objects and arrays, as parsed
+// from its JSON.
+func (engine *JsEngine) SetData(name string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	parsed, err := engine.parseJSON(goja.Undefined(), engine.vm.ToValue(string(data)))
+	if err != nil {
+		return err
+	}
+	return engine.vm.Set(name, parsed)
+}
+
+func (engine *JsEngine) UnsetData(name string) error {
+	return engine.vm.GlobalObject().Delete(name)
+}
+
+func (engine *JsEngine) SetDeadline(deadline time.Time) {
+	engine.deadline = deadline
+}
+
+// run runs the code, interrupting it at the deadline.
+func (engine *JsEngine) run(code string) (goja.Value, error) {
+	if !engine.deadline.IsZero() {
+		if !time.Now().Before(engine.deadline) {
+			return nil, render.ErrTimeout
+		}
+		timer := time.AfterFunc(time.Until(engine.deadline), func() {
+			engine.vm.Interrupt(render.ErrTimeout)
+		})
+		defer func() {
+			timer.Stop()
+			engine.vm.ClearInterrupt()
+		}()
+	}
+	program, err := compileJs(code)
+	if err != nil {
+		return nil, err
+	}
+	val, err := engine.vm.RunProgram(program)
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		return nil, render.ErrTimeout
+	}
+	var exception *goja.Exception
+	if errors.As(err, &exception) {
+		// the outermost frame is the position in the expression
+		stack := exception.Stack()
+		for i := len(stack) - 1; i >= 0; i-- {
+			if pos := stack[i].Position(); pos.Line > 0 {
+				return nil, &render.ExprError{Line: pos.Line, Column: pos.Column, Stack: exception.String(), Err: err}
+			}
+		}
+	}
+	return val, err
+}
+
+// compileJs compiles the code, a syntax error is located by the parser.
+func compileJs(code string) (*goja.Program, error) {
+	program, err := goja.Compile("", code, false)
+	var syntaxErr *goja.CompilerSyntaxError
+	if errors.As(err, &syntaxErr) {
+		var list parser.ErrorList
+		if _, parseErr := parser.ParseFile(nil, "", code, 0); errors.As(parseErr, &list) && len(list) > 0 {
+			pos := list[0].Position
+			return nil, &render.ExprError{Line: pos.Line, Column: pos.Column, Err: fmt.Errorf("SyntaxError: %s", list[0].Message)}
+		}
+	}
+	return program, err
+}
+
+func (engine *JsEngine) Eval(code string) (any, error) {
+	val, err := engine.run(code)
+	if err != nil {
+		return nil, err
+	}
+	return val.Export(), nil
+}
+
+func (engine *JsEngine) Exec(code string) error {
+	_, err := engine.run(code)
+	return err
+}
+
+// Check compiles the code, and collects its names from the syntax tree. A
+// name declared anywhere in the code is taken as declared everywhere in it,
+// only the top level declarations are global.
+func (engine *JsEngine) Check(code string, script bool) (*render.CodeInfo, error) {
+	if _, err := compileJs(code); err != nil {
+		return nil, err
+	}
+	program, err := parser.ParseFile(nil, "", code, 0)
+	if err != nil {
+		return nil, err
+	}
+	refs := []*ast.Identifier{}
+	defines := map[string]bool{}
+	jsNames(reflect.ValueOf(program), &refs, defines)
+
+	ret := &render.CodeInfo{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		name := ref.Name.String()
+		if defines[name] || seen[name] || engine.vm.GlobalObject().Get(name) != nil {
+			continue
+		}
+		seen[name] = true
+		pos := program.File.Position(int(ref.Idx) - program.File.Base())
+		ret.Refs = append(ret.Refs, render.CodeName{Name: name, Line: pos.Line, Column: pos.Column})
+	}
+	globals := map[string]bool{}
+	for _, statement := range program.Body {
+		switch statement := statement.(type) {
+		case *ast.VariableStatement:
+			for _, binding := range statement.List {
+				jsDefine(binding.Target, globals)
+			}
+		case *ast.LexicalDeclaration:
+			for _, binding := range statement.List {
+				jsDefine(binding.Target, globals)
+			}
+		case *ast.FunctionDeclaration:
+			jsDefine(statement.Function.Name, globals)
+		case *ast.ClassDeclaration:
+			jsDefine(statement.Class.Name, globals)
+		case *ast.ExpressionStatement:
+			if assign, ok := statement.Expression.(*ast.AssignExpression); ok && assign.Operator == token.ASSIGN {
+				jsDefine(assign.Left, globals)
+			}
+		}
+	}
+	for name := range globals {
+		ret.Defines = append(ret.Defines, name)
+	}
+	return ret, nil
+}
+
+// jsDefine marks the names bound by the target, an identifier or a pattern.
+func jsDefine(target ast.Expression, defines map[string]bool) {
+	if value := reflect.ValueOf(target); !value.IsValid() || value.IsNil() {
+		return
+	}
+	switch target := target.(type) {
+	case *ast.Identifier:
+		defines[target.Name.String()] = true
+	case *ast.ArrayPattern:
+		for _, element := range target.Elements {
+			jsDefine(element, defines)
+		}
+		jsDefine(target.Rest, defines)
+	case *ast.ObjectPattern:
+		for _, property := range target.Properties {
+			switch property := property.(type) {
+			case *ast.PropertyShort:
+				defines[property.Name.Name.String()] = true
+			case *ast.PropertyKeyed:
+				jsDefine(property.Value, defines)
+			}
+		}
+		jsDefine(target.Rest, defines)
+	case *ast.AssignExpression:
+		jsDefine(target.Left, defines)
+	}
+}
+
+// jsNames walks the syntax tree by reflection, collecting the identifiers read
+// and the names declared.
+func jsNames(value reflect.Value, refs *[]*ast.Identifier, defines map[string]bool) {
+	switch value.Kind() {
+	case reflect.Interface:
+		if !value.IsNil() {
+			jsNames(value.Elem(), refs, defines)
+		}
+	case reflect.Pointer:
+		if value.IsNil() || !value.CanInterface() {
+			return
+		}
+		switch node := value.Interface().(type) {
+		case *ast.Identifier:
+			*refs = append(*refs, node)
+			return
+		case *ast.MetaProperty:
+			return
+		case *ast.Binding:
+			jsDefine(node.Target, defines)
+		case *ast.AssignExpression:
+			if node.Operator == token.ASSIGN {
+				jsDefine(node.Left, defines)
+			}
+		case *ast.ParameterList:
+			jsDefine(node.Rest, defines)
+		case *ast.CatchStatement:
+			jsDefine(node.Parameter, defines)
+		case *ast.ForDeclaration:
+			jsDefine(node.Target, defines)
+		case *ast.FunctionLiteral:
+			jsDefine(node.Name, defines)
+		case *ast.ClassLiteral:
+			jsDefine(node.Name, defines)
+		case *ast.LabelledStatement:
+			jsDefine(node.Label, defines)
+		case *ast.BranchStatement:
+			jsDefine(node.Label, defines)
+		}
+		jsNames(value.Elem(), refs, defines)
+	case reflect.Struct:
+		if value.Type().PkgPath() != reflect.TypeOf(ast.Identifier{}).PkgPath() {
+			return
+		}
+		for i := 0; i < value.NumField(); i++ {
+			jsNames(value.Field(i), refs, defines)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			jsNames(value.Index(i), refs, defines)
+		}
+	}
+}
+
 func (engine *JsEngine) CalcValue(formula *render.FlowFormula) (data [][]any, rows int, cols int, err error) {
-	val, err := engine.vm.RunString(formula.Code)
+	val, err := engine.run(formula.Code)
 	if err != nil {
 		return nil, 0, 0, err
 	}
 	switch formula.Direct {
 	case render.FlowFormulaDirect_Table:
-		data = engine.extractValue(val, 2, formula.Format.Type).([][]any)
+		data = tableValue(engine.extractValue(val, 2, formula.Format.Type).([]any))
 		if len(data) == 0 {
 			data = append(data, []any{})
 		}
@@ -80,9 +400,58 @@ func (engine *JsEngine) CalcValue(formula *render.FlowFormula) (data [][]any, ro
 
 func (engine *JsEngine) extractValue(value goja.Value, level int, class string) any {
 	if level == 0 {
+		if object, ok := value.(*goja.Object); ok {
+			if inner, style := object.Get("value"), object.Get("style"); inner != nil && style != nil {
+				if style, err := normalizeValue(style.Export()); err == nil {
+					styleMap, _ := style.(map[string]any)
+					return render.FlowStyledValue{Value: engine.extractValue(inner, 0, class), Style: styleMap}
+				}
+			}
+		}
 		switch class {
-		case render.FlowFormulaFormat_String:
+		case render.FlowFormulaFormat_Auto:
+			if goja.IsUndefined(value) || goja.IsNull(value) {
+				return nil
+			}
+			switch val := value.Export().(type) {
+			case string:
+				return val
+			case bool:
+				return val
+			case int64:
+				return float64(val)
+			case float64:
+				return val
+			}
+			return value.String()
+		case render.FlowFormulaFormat_String, render.FlowFormulaFormat_Formula:
 			return value.ToString().String()
+		case render.FlowFormulaFormat_Link:
+			val, err := normalizeValue(value.Export())
+			if err != nil {
+				return nil
+			}
+			return linkValue(val)
+		case render.FlowFormulaFormat_Image:
+			switch val := value.Export().(type) {
+			case string:
+				return val
+			case []byte:
+				return val
+			case goja.ArrayBuffer:
+				return val.Bytes()
+			}
+			return nil
+		case render.FlowFormulaFormat_Date, render.FlowFormulaFormat_Time, render.FlowFormulaFormat_DateTime:
+			switch val := value.Export().(type) {
+			case time.Time:
+				return val
+			case string:
+				if ret, ok := parseTime(val); ok {
+					return ret
+				}
+			}
+			return nil
 		case render.FlowFormulaFormat_Int:
 			t := value.ExportType()
 			if t.Kind() == reflect.Float64 || t.Kind() == reflect.Int64 {
@@ -100,8 +469,7 @@ func (engine *JsEngine) extractValue(value goja.Value, level int, class string)
 		}
 	} else {
 		ret := []any{}
-		kind := value.ExportType().Kind()
-		if kind == reflect.Slice || kind == reflect.Array {
+		if t := value.ExportType(); t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && !(class == render.FlowFormulaFormat_Image && t == reflect.TypeOf([]byte{})) {
 			object := value.ToObject(engine.vm)
 			length := len(object.Export().([]any))
 			for i := 0; i < length; i++ {
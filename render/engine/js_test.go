@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestJsRequire(t *testing.T) {
+	dir := t.TempDir()
+	modules := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib", "fmt.js"), "module.exports = { label: n => 'Q' + n }\n")
+	writeFile(t, filepath.Join(dir, "node_modules", "local", "index.js"), "exports.name = 'local'\n")
+	writeFile(t, filepath.Join(modules, "shared", "index.js"), "exports.name = 'shared'\n")
+	engine := NewJsEngine()
+	if err := engine.EnableRequire(dir, modules); err != nil {
+		t.Fatal(err)
+	}
+	got, err := engine.Eval(`require("./lib/fmt.js").label(1) + require("local").name + require("shared").name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Q1localshared" {
+		t.Errorf("require = %v, want Q1localshared", got)
+	}
+	if _, err := engine.Eval(`require("./missing.js")`); err == nil {
+		t.Error("require of a missing module succeeded")
+	}
+}
+
+func TestJsRequireDisabled(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib.js"), "exports.x = 1\n")
+	engine := NewJsEngine()
+	if _, err := engine.Eval(`require("` + filepath.ToSlash(filepath.Join(dir, "lib.js")) + `")`); err == nil {
+		t.Error("require succeeded without EnableRequire")
+	}
+	if _, err := engine.Eval(`require("console")`); err != nil {
+		t.Errorf("require of the native console module: %v", err)
+	}
+}
+
+func TestJsTimeout(t *testing.T) {
+	engine := NewJsEngine()
+	engine.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := engine.Eval("while (true) {}"); !errors.Is(err, render.ErrTimeout) {
+		t.Errorf("error = %v, want %v", err, render.ErrTimeout)
+	}
+	// the engine is usable again after the interrupt
+	engine.SetDeadline(time.Time{})
+	if got, err := engine.Eval("1 + 1"); err != nil || got != int64(2) {
+		t.Errorf("Eval = %v, %v, want 2", got, err)
+	}
+}
+
+func TestJsCheck(t *testing.T) {
+	engine := NewJsEngine()
+	if err := engine.SetData("bound", 1); err != nil {
+		t.Fatal(err)
+	}
+	info, err := engine.Check("items.map(({ id }, i) => id + i + offset).concat(bound, Math.max(a.b))", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refNames(info); !reflect.DeepEqual(got, []string{"items", "offset", "a"}) {
+		t.Errorf("refs = %v", got)
+	}
+	if ref := info.Refs[1]; ref.Line != 1 || ref.Column != 35 {
+		t.Errorf("offset at %d:%d, want 1:35", ref.Line, ref.Column)
+	}
+
+	info, err = engine.Check("var rate = 2\nfunction label(n) { let local = n; return prefix + local }\nconst [x, ...rest] = list\ntotal = 1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(info.Defines)
+	if !reflect.DeepEqual(info.Defines, []string{"label", "rate", "rest", "total", "x"}) {
+		t.Errorf("defines = %v", info.Defines)
+	}
+	if got := refNames(info); !reflect.DeepEqual(got, []string{"prefix", "list"}) {
+		t.Errorf("refs = %v", got)
+	}
+
+	_, err = engine.Check("1 +\n(", false)
+	var exprErr *render.ExprError
+	if !errors.As(err, &exprErr) || exprErr.Line != 2 {
+		t.Errorf("error = %v, want a syntax error at line 2", err)
+	}
+}
+
+func TestJsData(t *testing.T) {
+	engine := NewJsEngine()
+	if err := engine.InitData(map[string]any{"data": map[string]any{"items": []any{3, 1, 2}}, "cell": "data"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.SetData("cell", map[string]any{"name": "A1"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]any{
+		"cell.name":                 "A1",
+		"Array.isArray(data.items)": true,
+		"data.items.push(4); data.items.sort().join()": "1,2,3,4",
+	}
+	for code, want := range tests {
+		if got, err := engine.Eval(code); err != nil || got != want {
+			t.Errorf("%s = %v, %v, want %v", code, got, err, want)
+		}
+	}
+}
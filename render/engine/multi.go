@@ -2,8 +2,12 @@ package engine
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/azurity/flow-table/render"
 )
@@ -33,24 +37,115 @@ func (engine *MultiEngine) InitData(data map[string]any) error {
 	return nil
 }
 
-var langRegExp = regexp.MustCompile(`^\[(\w+)\](.*)$`)
+var langRegExp = regexp.MustCompile(`(?s)^\[(\w+)\](.*)$`)
 
 var ErrWrongCodeFormat = errors.New("wrong code format")
 var ErrUnknownLang = errors.New("unknown language")
+var ErrSandboxNotSupported = errors.New("sandbox not supported")
 
-func (engine *MultiEngine) CalcValue(formula *render.FlowFormula) (data [][]any, rows int, cols int, err error) {
-	if !langRegExp.MatchString(formula.Code) {
-		return nil, 0, 0, ErrWrongCodeFormat
+func (engine *MultiEngine) SetData(name string, value any) error {
+	for _, impl := range engine.Engines {
+		if err := impl.SetData(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (engine *MultiEngine) UnsetData(name string) error {
+	for _, impl := range engine.Engines {
+		if err := impl.UnsetData(name); err != nil {
+			return err
+		}
 	}
-	match := langRegExp.FindStringSubmatch(formula.Code)
+	return nil
+}
+
+func (engine *MultiEngine) SetDeadline(deadline time.Time) {
+	for _, impl := range engine.Engines {
+		impl.SetDeadline(deadline)
+	}
+}
+
+func (engine *MultiEngine) selectEngine(code string) (render.RenderEngine, string, error) {
+	if !langRegExp.MatchString(code) {
+		return nil, "", ErrWrongCodeFormat
+	}
+	match := langRegExp.FindStringSubmatch(code)
 	lang, ok := engine.Alias[strings.ToLower(match[1])]
 	if !ok {
-		return nil, 0, 0, ErrUnknownLang
+		return nil, "", ErrUnknownLang
 	}
 	impl, ok := engine.Engines[lang]
 	if !ok {
-		return nil, 0, 0, ErrUnknownLang
+		return nil, "", ErrUnknownLang
+	}
+	return impl, match[2], nil
+}
+
+func (engine *MultiEngine) Eval(code string) (any, error) {
+	impl, code, err := engine.selectEngine(code)
+	if err != nil {
+		return nil, err
+	}
+	return impl.Eval(code)
+}
+
+func (engine *MultiEngine) Exec(code string) error {
+	impl, code, err := engine.selectEngine(code)
+	if err != nil {
+		return err
+	}
+	return impl.Exec(code)
+}
+
+func (engine *MultiEngine) CalcValue(formula *render.FlowFormula) (data [][]any, rows int, cols int, err error) {
+	impl, code, err := engine.selectEngine(formula.Code)
+	if err != nil {
+		return nil, 0, 0, err
 	}
-	formula.Code = match[2]
+	formula.Code = code
 	return impl.CalcValue(formula)
 }
+
+// Check checks the code in the engine picked by its language, the engines
+// which can't check code accept any.
+func (engine *MultiEngine) Check(code string, script bool) (*render.CodeInfo, error) {
+	impl, code, err := engine.selectEngine(code)
+	if err != nil {
+		return nil, err
+	}
+	checker, ok := impl.(render.Checker)
+	if !ok {
+		return &render.CodeInfo{}, nil
+	}
+	return checker.Check(code, script)
+}
+
+// LoadPrelude runs the script file in the engine picked by its extension,
+// such as `helpers.js` or `helpers.py`, before rendering.
+func (engine *MultiEngine) LoadPrelude(path string) error {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := engine.Exec(fmt.Sprintf("[%s]%s", ext, code)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// EnableSandbox sandboxes all the engines, it fails if any of them can't be sandboxed.
+func (engine *MultiEngine) EnableSandbox(opts SandboxOptions) error {
+	for name, impl := range engine.Engines {
+		sandboxed, ok := impl.(Sandboxed)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrSandboxNotSupported, name)
+		}
+		if err := sandboxed.EnableSandbox(opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
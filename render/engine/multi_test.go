@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func newEngines(t *testing.T) *MultiEngine {
+	t.Helper()
+	celEngine, err := NewCelEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMultiEngine(map[string]render.RenderEngine{
+		"js":  NewJsEngine(),
+		"py":  NewPyEngine(),
+		"cel": celEngine,
+	}, map[string]string{"javascript": "js"})
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadPrelude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "helpers.js"), "function label(n) {\n  return 'Q' + n\n}\n")
+	writeFile(t, filepath.Join(dir, "helpers.py"), "def double(x):\n    return x * 2\n")
+	writeFile(t, filepath.Join(dir, "alias.javascript"), "var unit = 'kg'\n")
+	engines := newEngines(t)
+	for _, name := range []string{"helpers.js", "helpers.py", "alias.javascript"} {
+		if err := engines.LoadPrelude(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := map[string]any{
+		"[js] label(2) + unit": "Q2kg",
+		"[py] str(double(21))": "42",
+	}
+	for code, want := range tests {
+		got, err := engines.Eval(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestLoadPreludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	engines := newEngines(t)
+	writeFile(t, filepath.Join(dir, "helpers.rb"), "def x; end")
+	if err := engines.LoadPrelude(filepath.Join(dir, "helpers.rb")); !errors.Is(err, ErrUnknownLang) {
+		t.Errorf("error = %v, want %v", err, ErrUnknownLang)
+	}
+	if err := engines.LoadPrelude(filepath.Join(dir, "missing.js")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("error = %v, want %v", err, os.ErrNotExist)
+	}
+	path := filepath.Join(dir, "broken.js")
+	writeFile(t, path, "function (")
+	err := engines.LoadPrelude(path)
+	if err == nil || err.Error()[:len(path)] != path {
+		t.Errorf("error = %v, want it prefixed with the path", err)
+	}
+}
+
+// refNames are the names of the refs, in order.
+func refNames(info *render.CodeInfo) []string {
+	ret := []string{}
+	for _, ref := range info.Refs {
+		ret = append(ret, ref.Name)
+	}
+	return ret
+}
+
+func TestMultiCheck(t *testing.T) {
+	engines := newEngines(t)
+	info, err := engines.Check("[javascript] total + 1", false)
+	if err != nil || !reflect.DeepEqual(refNames(info), []string{"total"}) {
+		t.Errorf("Check = %+v, %v", info, err)
+	}
+	if _, err := engines.Check("[rb] 1", false); !errors.Is(err, ErrUnknownLang) {
+		t.Errorf("error = %v, want %v", err, ErrUnknownLang)
+	}
+	engines.Engines["plain"] = plainEngine{}
+	engines.Alias["plain"] = "plain"
+	if info, err := engines.Check("[plain] anything (", false); err != nil || len(info.Refs) != 0 {
+		t.Errorf("Check of an engine which can't check = %+v, %v", info, err)
+	}
+}
@@ -1,20 +1,25 @@
 package engine
 
 import (
-	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/azurity/flow-table/render"
+	"github.com/go-python/gpython/parser"
 	"github.com/go-python/gpython/py"
+	"github.com/go-python/gpython/symtable"
 
 	_ "github.com/go-python/gpython/stdlib"
 )
 
 type PyEngine struct {
-	ctx    py.Context
-	module *py.Module
+	ctx      py.Context
+	module   *py.Module
+	deadline time.Time
 }
 
 func NewPyEngine() *PyEngine {
@@ -30,36 +35,192 @@ func NewPyEngine() *PyEngine {
 	}
 }
 
+// sandboxModules are the modules which can be imported in the sandbox.
+var sandboxModules = map[string]bool{
+	"math":     true,
+	"string":   true,
+	"binascii": true,
+}
+
+// EnableSandbox removes open, eval, exec and compile, and limits the imports
+// to the modules without file, OS or time access.
+func (engine *PyEngine) EnableSandbox(opts SandboxOptions) error {
+	builtins := engine.ctx.Store().Builtins.Globals
+	for _, name := range []string{"open", "eval", "exec", "compile"} {
+		delete(builtins, name)
+	}
+	builtins["__import__"] = py.MustNewMethod("__import__", func(self py.Object, args py.Tuple, kwargs py.StringDict) (py.Object, error) {
+		if len(args) == 0 {
+			return nil, py.ExceptionNewf(py.TypeError, "__import__() missing required argument 'name'")
+		}
+		name, ok := args[0].(py.String)
+		if !ok || !sandboxModules[strings.SplitN(string(name), ".", 2)[0]] {
+			return nil, py.ExceptionNewf(py.ImportError, "import of %v is not allowed", args[0])
+		}
+		globals := py.StringDict{}
+		if len(args) > 1 {
+			if dict, ok := args[1].(py.StringDict); ok {
+				globals = dict
+			}
+		}
+		return py.BuiltinImport(engine.ctx, self, args, kwargs, globals)
+	}, 0, "")
+	return nil
+}
+
 func (engine *PyEngine) InitData(data map[string]any) error {
 	for key, value := range data {
-		data, err := json.Marshal(value)
-		if err != nil {
-			return err
-		}
-		code, err := py.Compile(fmt.Sprintf("%s = %s\n", key, string(data)), "", py.SingleMode, 0, true)
-		if err != nil {
+		if err := engine.SetData(key, value); err != nil {
 			return err
 		}
-		_, err = engine.ctx.RunCode(code, engine.module.Globals, engine.module.Globals, nil)
-		if err != nil {
-			return err
+	}
+	return nil
+}
+
+func (engine *PyEngine) SetData(name string, value any) error {
+	value, err := normalizeValue(value)
+	if err != nil {
+		return err
+	}
+	engine.module.Globals[name] = toPyObject(value)
+	return nil
+}
+
+func (engine *PyEngine) UnsetData(name string) error {
+	delete(engine.module.Globals, name)
+	return nil
+}
+
+func (engine *PyEngine) SetDeadline(deadline time.Time) {
+	engine.deadline = deadline
+}
+
+// run runs the compiled code. The python vm can't be interrupted, so the
+// deadline is only checked before the code runs.
+func (engine *PyEngine) run(compiled *py.Code) (py.Object, error) {
+	if !engine.deadline.IsZero() && !time.Now().Before(engine.deadline) {
+		return nil, render.ErrTimeout
+	}
+	return engine.ctx.RunCode(compiled, engine.module.Globals, engine.module.Globals, nil)
+}
+
+// locatePyError locates the syntax error by its line and offset, or the
+// runtime error by the outermost line of its traceback.
+func locatePyError(err error) error {
+	if exception, ok := err.(*py.Exception); ok {
+		line, _ := exception.Dict["lineno"].(py.Int)
+		offset, _ := exception.Dict["offset"].(py.Int)
+		if line > 0 {
+			message := err
+			if args, ok := exception.Args.(py.Tuple); ok && len(args) > 0 {
+				message = fmt.Errorf("%s: %v", exception.Base.Name, args[0])
+			}
+			return &render.ExprError{Line: int(line), Column: int(offset), Err: message}
 		}
 	}
+	if info, ok := err.(py.ExceptionInfo); ok && info.Traceback != nil && info.Traceback.Lineno > 0 {
+		stack := &strings.Builder{}
+		info.TracebackDump(stack)
+		return &render.ExprError{Line: int(info.Traceback.Lineno), Stack: stack.String(), Err: err}
+	}
+	return err
+}
+
+func (engine *PyEngine) eval(code string) (py.Object, error) {
+	compiled, err := py.Compile(strings.TrimSpace(code), "", py.EvalMode, 0, true)
+	if err != nil {
+		return nil, locatePyError(err)
+	}
+	val, err := engine.run(compiled)
+	if err != nil {
+		return nil, locatePyError(err)
+	}
+	return val, nil
+}
+
+func (engine *PyEngine) Eval(code string) (any, error) {
+	val, err := engine.eval(code)
+	if err != nil {
+		return nil, err
+	}
+	return fromPyObject(val), nil
+}
+
+func (engine *PyEngine) Exec(code string) error {
+	compiled, err := py.Compile(strings.TrimSpace(code)+"\n", "", py.ExecMode, 0, true)
+	if err != nil {
+		return locatePyError(err)
+	}
+	if _, err := engine.run(compiled); err != nil {
+		return locatePyError(err)
+	}
 	return nil
 }
 
-func (engine *PyEngine) CalcValue(formula *render.FlowFormula) (data [][]any, rows int, cols int, err error) {
-	code, err := py.Compile(formula.Code, "", py.EvalMode, 0, true)
+// Check compiles the code, and takes its global names from the symbol table.
+func (engine *PyEngine) Check(code string, script bool) (*render.CodeInfo, error) {
+	mode, src := py.EvalMode, strings.TrimSpace(code)
+	if script {
+		mode, src = py.ExecMode, src+"\n"
+	}
+	if _, err := py.Compile(src, "", mode, 0, true); err != nil {
+		return nil, locatePyError(err)
+	}
+	tree, err := parser.ParseString(src, mode)
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, locatePyError(err)
 	}
-	val, err := engine.ctx.RunCode(code, engine.module.Globals, engine.module.Globals, nil)
+	top, err := symtable.NewSymTable(tree, "")
+	if err != nil {
+		return nil, locatePyError(err)
+	}
+
+	ret := &render.CodeInfo{}
+	for name, symbol := range top.Symbols {
+		if symbol.Flags&symtable.DefBound != 0 {
+			ret.Defines = append(ret.Defines, name)
+		}
+	}
+	builtins := engine.ctx.Store().Builtins.Globals
+	seen := map[string]bool{}
+	var walk func(table *symtable.SymTable)
+	walk = func(table *symtable.SymTable) {
+		for name, symbol := range table.Symbols {
+			global := table == top || symbol.Scope == symtable.ScopeGlobalImplicit || symbol.Scope == symtable.ScopeGlobalExplicit
+			if !global || symbol.Flags&symtable.DefUse == 0 || top.Symbols[name].Flags&symtable.DefBound != 0 || seen[name] {
+				continue
+			}
+			if _, ok := builtins[name]; ok {
+				continue
+			}
+			if _, ok := engine.module.Globals[name]; ok {
+				continue
+			}
+			seen[name] = true
+			ret.Refs = append(ret.Refs, render.CodeName{Name: name, Line: symbol.Lineno, Column: symbol.ColOffset + 1})
+		}
+		for _, child := range table.Children {
+			walk(child)
+		}
+	}
+	walk(top)
+	sort.Slice(ret.Refs, func(i, j int) bool {
+		if ret.Refs[i].Line != ret.Refs[j].Line {
+			return ret.Refs[i].Line < ret.Refs[j].Line
+		}
+		return ret.Refs[i].Column < ret.Refs[j].Column
+	})
+	return ret, nil
+}
+
+func (engine *PyEngine) CalcValue(formula *render.FlowFormula) (data [][]any, rows int, cols int, err error) {
+	val, err := engine.eval(formula.Code)
 	if err != nil {
 		return nil, 0, 0, err
 	}
 	switch formula.Direct {
 	case render.FlowFormulaDirect_Table:
-		data = engine.extractValue(val, 2, formula.Format.Type).([][]any)
+		data = tableValue(engine.extractValue(val, 2, formula.Format.Type).([]any))
 		if len(data) == 0 {
 			data = append(data, []any{})
 		}
@@ -95,16 +256,145 @@ func (engine *PyEngine) CalcValue(formula *render.FlowFormula) (data [][]any, ro
 	return data, rows, cols, nil
 }
 
+func toPyObject(value any) py.Object {
+	switch val := value.(type) {
+	case bool:
+		return py.NewBool(val)
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return py.Int(val)
+		}
+		return py.Float(val)
+	case string:
+		return py.String(val)
+	case []any:
+		items := []py.Object{}
+		for _, item := range val {
+			items = append(items, toPyObject(item))
+		}
+		return py.NewListFromItems(items)
+	case map[string]any:
+		dict := py.NewStringDict()
+		for key, item := range val {
+			dict[key] = toPyObject(item)
+		}
+		return dict
+	default:
+		return py.None
+	}
+}
+
+func fromPyObject(value py.Object) any {
+	switch val := value.(type) {
+	case py.NoneType:
+		return nil
+	case py.Bool:
+		return bool(val)
+	case py.Int:
+		return int64(val)
+	case *py.BigInt:
+		ret, _ := py.FloatAsFloat64(val)
+		return ret
+	case py.Float:
+		return float64(val)
+	case py.String:
+		return string(val)
+	case *py.List:
+		return fromPyObjects(val.Items)
+	case py.Tuple:
+		return fromPyObjects(val)
+	case py.StringDict:
+		ret := map[string]any{}
+		for key, item := range val {
+			ret[key] = fromPyObject(item)
+		}
+		return ret
+	default:
+		out, err := py.Str(value)
+		if err != nil {
+			return nil
+		}
+		str, _ := py.StrAsString(out)
+		return str
+	}
+}
+
+func fromPyObjects(values []py.Object) []any {
+	ret := []any{}
+	for _, item := range values {
+		ret = append(ret, fromPyObject(item))
+	}
+	return ret
+}
+
 func (engine *PyEngine) extractValue(value py.Object, level int, class string) any {
 	if level == 0 {
+		if dict, ok := value.(py.StringDict); ok {
+			inner, hasValue := dict["value"]
+			style, hasStyle := dict["style"]
+			if hasValue && hasStyle {
+				styleMap, _ := fromPyObject(style).(map[string]any)
+				return render.FlowStyledValue{Value: engine.extractValue(inner, 0, class), Style: styleMap}
+			}
+		}
 		switch class {
-		case render.FlowFormulaFormat_String:
+		case render.FlowFormulaFormat_Auto:
+			switch val := value.(type) {
+			case py.NoneType:
+				return nil
+			case py.Bool:
+				return bool(val)
+			case py.String:
+				return string(val)
+			case py.Int, *py.BigInt, py.Float:
+				ret, err := py.FloatAsFloat64(val)
+				if err != nil {
+					return nil
+				}
+				return ret
+			}
+			out, err := py.Str(value)
+			if err != nil {
+				return nil
+			}
+			str, _ := py.StrAsString(out)
+			return str
+		case render.FlowFormulaFormat_String, render.FlowFormulaFormat_Formula:
 			out, err := py.Str(value)
 			if err != nil {
 				return ""
 			}
 			str, _ := py.StrAsString(out)
 			return str
+		case render.FlowFormulaFormat_Link:
+			return linkValue(fromPyObject(value))
+		case render.FlowFormulaFormat_Image:
+			switch val := value.(type) {
+			case py.String:
+				return string(val)
+			case py.Bytes:
+				return []byte(val)
+			}
+			return nil
+		case render.FlowFormulaFormat_Date, render.FlowFormulaFormat_Time, render.FlowFormulaFormat_DateTime:
+			if value.Type() != py.StringType {
+				isoformat, err := py.GetAttrString(value, "isoformat")
+				if err != nil {
+					return nil
+				}
+				value, err = py.Call(isoformat, nil, nil)
+				if err != nil {
+					return nil
+				}
+			}
+			str, err := py.StrAsString(value)
+			if err != nil {
+				return nil
+			}
+			if ret, ok := parseTime(str); ok {
+				return ret
+			}
+			return nil
 		case render.FlowFormulaFormat_Int:
 			if value.Type() == py.IntType {
 				ret, err := value.(py.Int).GoInt()
@@ -132,7 +422,7 @@ func (engine *PyEngine) extractValue(value py.Object, level int, class string) a
 		}
 	} else {
 		ret := []any{}
-		if rawLen, err := py.Len(value); err == nil && value.Type() != py.StringType {
+		if rawLen, err := py.Len(value); err == nil && value.Type() != py.StringType && value.Type() != py.BytesType && value.Type() != py.StringDictType {
 			length, err := rawLen.(py.Int).GoInt()
 			if err != nil {
 				return []any{}
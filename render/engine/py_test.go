@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestPyDeadline(t *testing.T) {
+	engine := NewPyEngine()
+	if err := engine.SetData("n", 1); err != nil {
+		t.Fatal(err)
+	}
+	// the deadline is checked before the code runs
+	engine.SetDeadline(time.Now().Add(-time.Second))
+	if _, err := engine.Eval("n"); !errors.Is(err, render.ErrTimeout) {
+		t.Fatalf("error = %v, want %v", err, render.ErrTimeout)
+	}
+	engine.SetDeadline(time.Now().Add(time.Minute))
+	if got, err := engine.Eval("n + 1"); err != nil || got != int64(2) {
+		t.Errorf("Eval = %v, %v, want 2", got, err)
+	}
+}
+
+func TestPyCheck(t *testing.T) {
+	engine := NewPyEngine()
+	if err := engine.SetData("bound", 1); err != nil {
+		t.Fatal(err)
+	}
+	info, err := engine.Check("[x * rate for x in items] + [len(bound)]", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refNames(info); !reflect.DeepEqual(got, []string{"rate", "items"}) {
+		t.Errorf("refs = %v", got)
+	}
+
+	info, err = engine.Check("import math\ndef label(n):\n    local = n\n    return prefix + local\nrate = 2", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(info.Defines)
+	if !reflect.DeepEqual(info.Defines, []string{"label", "math", "rate"}) {
+		t.Errorf("defines = %v", info.Defines)
+	}
+	if got := refNames(info); !reflect.DeepEqual(got, []string{"prefix"}) {
+		t.Errorf("refs = %v", got)
+	}
+	if ref := info.Refs[0]; ref.Line != 4 {
+		t.Errorf("prefix at line %d, want 4", ref.Line)
+	}
+
+	_, err = engine.Check("(1 +", false)
+	var exprErr *render.ExprError
+	if !errors.As(err, &exprErr) || exprErr.Line != 1 {
+		t.Errorf("error = %v, want a syntax error at line 1", err)
+	}
+}
@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"time"
+)
+
+// SandboxOptions is the deterministic environment of sandboxed engines, so
+// the rendered files can be reproduced exactly.
+type SandboxOptions struct {
+	Clock time.Time // the fixed current time, the unix epoch if zero
+	Seed  int64     // the seed of the random source
+}
+
+func (opts SandboxOptions) clock() time.Time {
+	if opts.Clock.IsZero() {
+		return time.Unix(0, 0).UTC()
+	}
+	return opts.Clock
+}
+
+// Sandboxed is implemented by the engines which can run untrusted templates.
+// A sandboxed engine has no access to files, OS and real time, and can't run
+// dynamic code.
+type Sandboxed interface {
+	EnableSandbox(opts SandboxOptions) error
+}
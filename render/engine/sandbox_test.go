@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/azurity/flow-table/render"
+)
+
+// plainEngine is an engine which can't be sandboxed.
+type plainEngine struct {
+	render.RenderEngine
+}
+
+func sandboxedEngines(t *testing.T, opts SandboxOptions) *MultiEngine {
+	t.Helper()
+	engines := newEngines(t)
+	if err := engines.EnableSandbox(opts); err != nil {
+		t.Fatal(err)
+	}
+	return engines
+}
+
+func TestSandboxForbidden(t *testing.T) {
+	engines := sandboxedEngines(t, SandboxOptions{})
+	for _, code := range []string{
+		`[js] eval("1")`,
+		`[js] Function("return 1")()`,
+		`[js] (() => 1).constructor("return 1")()`,
+		`[js] require("./lib.js")`,
+		`[js] "use strict"; Object.prototype.polluted = 1`,
+		`[py] open("/etc/passwd")`,
+		`[py] eval("1")`,
+		`[py] __import__("os")`,
+	} {
+		if _, err := engines.Eval(code); err == nil {
+			t.Errorf("%s is not forbidden", code)
+		}
+	}
+	if got, err := engines.Eval(`[py] __import__("math").floor(1.5)`); err != nil || got != int64(1) {
+		t.Errorf("import of math = %v, %v", got, err)
+	}
+}
+
+func TestSandboxDeterministic(t *testing.T) {
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := sandboxedEngines(t, SandboxOptions{Clock: clock, Seed: 7})
+	second := sandboxedEngines(t, SandboxOptions{Clock: clock, Seed: 7})
+	for _, code := range []string{"[js] new Date().toISOString()", "[js] Math.random()"} {
+		a, err := first.Eval(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := second.Eval(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a != b {
+			t.Errorf("%s = %v and %v", code, a, b)
+		}
+	}
+	if got, _ := first.Eval("[js] new Date().toISOString()"); got != "2026-01-02T03:04:05.000Z" {
+		t.Errorf("clock = %v", got)
+	}
+	if got, _ := sandboxedEngines(t, SandboxOptions{}).Eval("[js] Date.now()"); got != int64(0) {
+		t.Errorf("default clock = %v, want the unix epoch", got)
+	}
+}
+
+func TestSandboxNotSupported(t *testing.T) {
+	engines := NewMultiEngine(map[string]render.RenderEngine{"plain": plainEngine{}}, map[string]string{})
+	if err := engines.EnableSandbox(SandboxOptions{}); !errors.Is(err, ErrSandboxNotSupported) {
+		t.Errorf("error = %v, want %v", err, ErrSandboxNotSupported)
+	}
+}
@@ -0,0 +1,182 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	ErrorPolicy_Strict  string = "strict"  // abort at the first error
+	ErrorPolicy_Collect string = "collect" // skip the failed cells and return all the errors
+	ErrorPolicy_Lenient string = "lenient" // collect the errors and mark the failed cells
+)
+
+const errorMarker = "#FLOW!"
+
+var errorMarkerStyle = map[string]any{"fill": "#FFC7CE", "color": "#9C0006"}
+
+// ExprError is an error of an engine located in the expression, the line and
+// column start at 1, and are 0 if unknown.
+type ExprError struct {
+	Line   int
+	Column int
+	Stack  string // the call stack printed by the engine, empty if none
+	Err    error
+}
+
+func (err *ExprError) Error() string {
+	return fmt.Sprintf("%s: %v", position(err.Line, err.Column), err.Err)
+}
+
+func position(line int, column int) string {
+	if column == 0 {
+		return strconv.Itoa(line)
+	}
+	return fmt.Sprintf("%d:%d", line, column)
+}
+
+func (err *ExprError) Unwrap() error {
+	return err.Err
+}
+
+// RenderError is an error of a template cell.
+type RenderError struct {
+	Sheet   string
+	Cell    string
+	Formula string // text of the template cell
+	Engine  string // language of the failed expression, empty if none
+	Line    int    // position in the expression, 0 if unknown
+	Column  int
+	Err     error
+}
+
+var engineRegExp = regexp.MustCompile(`^\s*\[(\w+)\]`)
+
+// newRenderError locates the error of the expression code in the cell.
+func newRenderError(sheet string, cellName string, text string, code string, err error) *RenderError {
+	ret := &RenderError{
+		Sheet:   sheet,
+		Cell:    cellName,
+		Formula: text,
+		Err:     err,
+	}
+	if match := engineRegExp.FindStringSubmatch(code); match != nil {
+		ret.Engine = strings.ToLower(match[1])
+	}
+	var exprErr *ExprError
+	if errors.As(err, &exprErr) {
+		ret.Line, ret.Column = exprErr.Line, exprErr.Column
+	}
+	return ret
+}
+
+func (err *RenderError) Error() string {
+	if err.Engine != "" {
+		return fmt.Sprintf("%s!%s: [%s] %v", err.Sheet, err.Cell, err.Engine, err.Err)
+	}
+	return fmt.Sprintf("%s!%s: %v", err.Sheet, err.Cell, err.Err)
+}
+
+func (err *RenderError) Unwrap() error {
+	return err.Err
+}
+
+// RenderErrors is all the errors of a rendering under the collect policy.
+type RenderErrors []*RenderError
+
+func (errs RenderErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%d errors, first: %v", len(errs), errs[0])
+}
+
+func (errs RenderErrors) Unwrap() []error {
+	ret := []error{}
+	for _, err := range errs {
+		ret = append(ret, err)
+	}
+	return ret
+}
+
+// Table formats the errors as a table of cell, engine, position, error and formula.
+func (errs RenderErrors) Table() string {
+	builder := &strings.Builder{}
+	writer := tabwriter.NewWriter(builder, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "CELL\tENGINE\tPOS\tERROR\tFORMULA")
+	for _, err := range errs {
+		engine, pos, message := "-", "-", err.Err
+		if err.Engine != "" {
+			engine = err.Engine
+		}
+		if err.Line > 0 {
+			pos = position(err.Line, err.Column)
+		}
+		var exprErr *ExprError
+		if errors.As(message, &exprErr) {
+			message = exprErr.Err
+		}
+		fmt.Fprintf(writer, "%s!%s\t%s\t%s\t%s\t%s\n", err.Sheet, err.Cell, engine, pos, oneLine(message.Error()), oneLine(err.Formula))
+	}
+	writer.Flush()
+	return builder.String()
+}
+
+func oneLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// fail handles the error of a cell by the policy, it returns the error when
+// the rendering has to stop. A budget or memory exceeded always stops it.
+func (state *renderState) fail(err *RenderError) error {
+	if state.opts.Policy != ErrorPolicy_Collect && state.opts.Policy != ErrorPolicy_Lenient {
+		return err
+	}
+	state.errors = append(state.errors, err)
+	if errors.Is(err, ErrBudgetExceeded) || errors.Is(err, ErrMemoryExceeded) {
+		return state.errors
+	}
+	return nil
+}
+
+// markCell replaces the failed cell by the error marker under the lenient
+// policy, styled in red with the error and its stack as comment.
+func (state *renderState) markCell(workbook *excelize.File, cellErr *RenderError) error {
+	if state.opts.Policy != ErrorPolicy_Lenient {
+		return nil
+	}
+	sheet, cellName := cellErr.Sheet, cellErr.Cell
+	if err := workbook.SetCellStr(sheet, cellName, errorMarker); err != nil {
+		return err
+	}
+	styleId, err := workbook.GetCellStyle(sheet, cellName)
+	if err != nil {
+		return err
+	}
+	style, err := state.styles.get(workbook, styleId, "General", errorMarkerStyle)
+	if err != nil {
+		return err
+	}
+	if err := workbook.SetCellStyle(sheet, cellName, cellName, style); err != nil {
+		return err
+	}
+	text := cellErr.Error()
+	var exprErr *ExprError
+	if errors.As(cellErr, &exprErr) && exprErr.Stack != "" {
+		text = strings.TrimSpace(exprErr.Stack)
+	}
+	if err := workbook.DeleteComment(sheet, cellName); err != nil {
+		return err
+	}
+	return workbook.AddComment(sheet, excelize.Comment{
+		Author: noteAuthor,
+		Cell:   cellName,
+		Text:   text,
+	})
+}
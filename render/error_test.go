@@ -0,0 +1,58 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewRenderError(t *testing.T) {
+	cause := errors.New("ReferenceError: x is not defined")
+	err := newRenderError("Sheet1", "B2", "{{[JS] x}}", "[JS] x", &ExprError{Line: 1, Column: 2, Err: cause})
+	if err.Engine != "js" || err.Line != 1 || err.Column != 2 {
+		t.Errorf("located at [%s] %d:%d, want [js] 1:2", err.Engine, err.Line, err.Column)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("%v does not wrap the cause", err)
+	}
+	if got, want := err.Error(), "Sheet1!B2: [js] 1:2: ReferenceError: x is not defined"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	err = newRenderError("Sheet1", "A1", "{{#each}}", "", ErrUnexpectedBlockEnd)
+	if err.Engine != "" || err.Line != 0 {
+		t.Errorf("located at [%s] %d, want nothing", err.Engine, err.Line)
+	}
+	if got, want := err.Error(), "Sheet1!A1: "+ErrUnexpectedBlockEnd.Error(); got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	errs := RenderErrors{
+		newRenderError("Sheet1", "A1", "{{[js] x\n+ 1}}", "[js] x\n+ 1", &ExprError{Line: 2, Err: errors.New("bad\nvalue")}),
+		newRenderError("Other", "C3", "{{[py] y}}", "[py] y", ErrTimeout),
+	}
+	if !errors.Is(errs, ErrTimeout) {
+		t.Error("the errors do not wrap each error")
+	}
+	if got, want := errs.Error(), "2 errors, first: "+errs[0].Error(); got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	if got, want := errs[:1].Error(), errs[0].Error(); got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	lines := strings.Split(strings.TrimSpace(errs.Table()), "\n")
+	want := [][]string{
+		{"CELL", "ENGINE", "POS", "ERROR", "FORMULA"},
+		{"Sheet1!A1", "js", "2", "bad value", "{{[js] x + 1}}"},
+		{"Other!C3", "py", "-", ErrTimeout.Error(), "{{[py] y}}"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("table:\n%s", errs.Table())
+	}
+	for i, line := range lines {
+		if fields := strings.Join(strings.Fields(line), " "); fields != strings.Join(want[i], " ") {
+			t.Errorf("row %d = %q, want %q", i, fields, strings.Join(want[i], " "))
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package render
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -21,24 +24,69 @@ var FlowFormulaDirectName = map[string]int{
 }
 
 const (
-	FlowFormulaFormat_String  string = "s" // string
-	FlowFormulaFormat_Float   string = "f" // float64
-	FlowFormulaFormat_Int     string = "d" // int
-	FlowFormulaFormat_Percent string = "p" // float64
+	FlowFormulaFormat_Auto     string = "a"    // string, float64, bool or nil
+	FlowFormulaFormat_String   string = "s"    // string
+	FlowFormulaFormat_Float    string = "f"    // float64
+	FlowFormulaFormat_Int      string = "d"    // int
+	FlowFormulaFormat_Percent  string = "p"    // float64
+	FlowFormulaFormat_Date     string = "D"    // time.Time
+	FlowFormulaFormat_Time     string = "t"    // time.Time
+	FlowFormulaFormat_DateTime string = "dt"   // time.Time
+	FlowFormulaFormat_Formula  string = "="    // string
+	FlowFormulaFormat_Link     string = "link" // FlowLink
+	FlowFormulaFormat_Image    string = "img"  // string or []byte
 )
 
+var defaultTimePattern = map[string]string{
+	FlowFormulaFormat_Date:     "yyyy-mm-dd",
+	FlowFormulaFormat_Time:     "hh:mm:ss",
+	FlowFormulaFormat_DateTime: "yyyy-mm-dd hh:mm:ss",
+}
+
 type FlowFormulaFormat struct {
 	Type       string
 	Constraint int
+	Pattern    string
+	Fit        bool
 }
 
+var timeFormatRegExp = regexp.MustCompile(`^(?P<class>D|t|dt)(\((?P<pattern>.+)\))?$`)
+var imageFormatRegExp = regexp.MustCompile(`^img(\((?P<mode>fit)\))?$`)
+
 func ParseFlowFormulaFormat(value string) FlowFormulaFormat {
+	if timeFormatRegExp.MatchString(value) {
+		match := timeFormatRegExp.FindStringSubmatch(value)
+		return FlowFormulaFormat{
+			Type:    match[timeFormatRegExp.SubexpIndex("class")],
+			Pattern: match[timeFormatRegExp.SubexpIndex("pattern")],
+		}
+	}
+	if imageFormatRegExp.MatchString(value) {
+		match := imageFormatRegExp.FindStringSubmatch(value)
+		return FlowFormulaFormat{
+			Type: FlowFormulaFormat_Image,
+			Fit:  match[imageFormatRegExp.SubexpIndex("mode")] == "fit",
+		}
+	}
+	if value == FlowFormulaFormat_Link {
+		return FlowFormulaFormat{
+			Type: FlowFormulaFormat_Link,
+		}
+	}
 	class := string([]byte{value[len(value)-1]})
 	switch class {
+	case FlowFormulaFormat_Auto:
+		return FlowFormulaFormat{
+			Type: FlowFormulaFormat_Auto,
+		}
 	case FlowFormulaFormat_String:
 		return FlowFormulaFormat{
 			Type: FlowFormulaFormat_String,
 		}
+	case FlowFormulaFormat_Formula:
+		return FlowFormulaFormat{
+			Type: FlowFormulaFormat_Formula,
+		}
 	case FlowFormulaFormat_Int:
 		var i int64 = -1
 		if len(value) > 1 {
@@ -64,6 +112,9 @@ func ParseFlowFormulaFormat(value string) FlowFormulaFormat {
 }
 
 func (format FlowFormulaFormat) GenerateFormatStr() *string {
+	if format.Pattern != "" {
+		return &format.Pattern
+	}
 	ret := "General"
 	constraint := format.Constraint
 	if constraint < 0 {
@@ -71,47 +122,192 @@ func (format FlowFormulaFormat) GenerateFormatStr() *string {
 	}
 	switch format.Type {
 	case FlowFormulaFormat_Percent:
-		ret = "0." + strings.Repeat("0", format.Constraint) + "%"
+		ret = "0." + strings.Repeat("0", constraint) + "%"
 	case FlowFormulaFormat_Float:
-		ret = "0." + strings.Repeat("0", format.Constraint)
+		ret = "0." + strings.Repeat("0", constraint)
+	case FlowFormulaFormat_Date, FlowFormulaFormat_Time, FlowFormulaFormat_DateTime:
+		ret = defaultTimePattern[format.Type]
 	}
 	return &ret
 }
 
 type FlowFormula struct {
+	Name   string // name of the rendered area, empty if unnamed
 	Direct int
 	Format FlowFormulaFormat
 	Code   string
+	Note   string // expression of the comments, empty if none
+	Style  string // expression of the cell styles, empty if none
+	Rules  []FlowRule
+}
+
+var formulaRegExp = regexp.MustCompile(`^\{\{(?P<body>.+)\}\}$`)
+var formulaHeadRegExp = regexp.MustCompile(`^(?P<direct>C|H|V|T)(#(?P<name>\w+))?`)
+var formatRegExp = regexp.MustCompile(`^(a|s|=|link|img(\(fit\))?|(\.\d+)?[fp]|\d*d|(D|t|dt)(\(.+\))?)$`)
+var formatOptionRegExp = regexp.MustCompile(`^(?P<key>\w+)[:=](?P<value>.*)$`)
+
+// scanFormat calls fn with each character of the format outside quotes, and
+// the depth of the parentheses around it, until fn returns false.
+func scanFormat(value string, fn func(i int, ch rune, depth int) bool) {
+	depth := 0
+	var quote rune
+	escape := false
+	for i, ch := range value {
+		switch {
+		case escape:
+			escape = false
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				escape = true
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '`':
+			quote = ch
+		default:
+			if ch == ')' {
+				depth -= 1
+			}
+			if !fn(i, ch, depth) {
+				return
+			}
+			if ch == '(' {
+				depth += 1
+			}
+		}
+	}
 }
 
-var formulaRegExp = regexp.MustCompile(`^\{\{((?P<direct>C|H|V|T)(\((?P<format>.+)\))?\|)?(?P<exp>.+)\}\}$`)
-var formatRegExp = regexp.MustCompile(`s|((\.\d+)?f|p)|\d*d`)
+// splitFormat splits the format into the class and its options by sep,
+// ignoring separators inside quotes and parentheses.
+func splitFormat(value string, sep rune) []string {
+	parts := []string{}
+	start := 0
+	scanFormat(value, func(i int, ch rune, depth int) bool {
+		if ch == sep && depth == 0 {
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+		return true
+	})
+	return append(parts, value[start:])
+}
+
+// splitFormula splits the text between the braces into the head, such as
+// `V#name(format)|`, and the expression. The format ends at the parenthesis
+// closing it, so an option may hold parentheses and `|` of its own.
+func splitFormula(body string) (direct string, name string, format string, exp string) {
+	head := formulaHeadRegExp.FindStringSubmatch(body)
+	if head == nil {
+		return "", "", "", body
+	}
+	direct, name = head[formulaHeadRegExp.SubexpIndex("direct")], head[formulaHeadRegExp.SubexpIndex("name")]
+	rest := body[len(head[0]):]
+	if strings.HasPrefix(rest, "|") && len(rest) > 1 {
+		return direct, name, "", rest[1:]
+	}
+	if !strings.HasPrefix(rest, "(") {
+		return "", "", "", body
+	}
+	end := -1
+	scanFormat(rest, func(i int, ch rune, depth int) bool {
+		if ch == ')' && depth == 0 {
+			end = i
+			return false
+		}
+		return true
+	})
+	if end <= 1 || !strings.HasPrefix(rest[end+1:], "|") || len(rest) <= end+2 {
+		return "", "", "", body
+	}
+	return direct, name, rest[1:end], rest[end+2:]
+}
+
+func unquoteOption(value string) string {
+	if ret, err := strconv.Unquote(value); err == nil {
+		return ret
+	}
+	return value
+}
+
+var ErrUnknownFormat = errors.New("unknown format")
+var ErrUnknownOption = errors.New("unknown format option")
 
 func TryParseFlowFormula(value string) *FlowFormula {
+	ret, _ := ParseFlowFormula(value)
+	return ret
+}
+
+// ParseFlowFormula is TryParseFlowFormula telling why the format is rejected.
+// It returns nil and no error if the value is not a formula.
+func ParseFlowFormula(value string) (*FlowFormula, error) {
 	if !formulaRegExp.MatchString(value) {
-		return nil
+		return nil, nil
 	}
 	match := formulaRegExp.FindStringSubmatch(value)
+	directName, name, format, code := splitFormula(match[formulaRegExp.SubexpIndex("body")])
 
-	direct, ok := FlowFormulaDirectName[match[formulaRegExp.SubexpIndex("direct")]]
+	direct, ok := FlowFormulaDirectName[directName]
 	if !ok {
 		direct = FlowFormulaDirect_Cell
 	}
 
-	rawFormat := match[formulaRegExp.SubexpIndex("format")]
-	if !formatRegExp.MatchString(rawFormat) {
-		return nil
+	parts := splitFormat(format, ';')
+	class, options := parts[0], parts[1:]
+	if formatOptionRegExp.MatchString(class) {
+		class, options = "", parts
+	}
+	if class == "" {
+		class = FlowFormulaFormat_Auto
+	}
+	if !formatRegExp.MatchString(class) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, class)
 	}
 
 	ret := &FlowFormula{
+		Name:   name,
 		Direct: direct,
-		Format: ParseFlowFormulaFormat(rawFormat),
-		Code:   match[formulaRegExp.SubexpIndex("exp")],
+		Format: ParseFlowFormulaFormat(class),
+		Code:   code,
 	}
-	return ret
+	for _, option := range options {
+		if !formatOptionRegExp.MatchString(option) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownOption, option)
+		}
+		optionMatch := formatOptionRegExp.FindStringSubmatch(option)
+		value := optionMatch[formatOptionRegExp.SubexpIndex("value")]
+		switch optionMatch[formatOptionRegExp.SubexpIndex("key")] {
+		case "fmt":
+			ret.Format.Pattern = unquoteOption(value)
+		case "note":
+			ret.Note = strings.TrimSpace(value)
+		case "style":
+			ret.Style = strings.TrimSpace(value)
+		case "cf":
+			rule := TryParseFlowRule(value)
+			if rule == nil {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownOption, option)
+			}
+			ret.Rules = append(ret.Rules, *rule)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownOption, option)
+		}
+	}
+	return ret, nil
 }
 
 type RenderEngine interface {
 	InitData(data map[string]any) error
+	// SetData binds a single variable, replacing the previous value of the same name.
+	SetData(name string, value any) error
+	// UnsetData removes a variable bound by SetData.
+	UnsetData(name string) error
+	// Eval runs the code and exports the result as a plain go value.
+	Eval(code string) (any, error)
+	// Exec runs the code as statements, such as definitions of helper functions.
+	Exec(code string) error
 	CalcValue(formula *FlowFormula) (data [][]any, rows int, cols int, err error)
+	// SetDeadline limits the time of the following evaluations, which fail
+	// with ErrTimeout once it passes. The zero time means no limit.
+	SetDeadline(deadline time.Time)
 }
@@ -0,0 +1,121 @@
+package render
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTimeFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    FlowFormulaFormat
+		pattern string
+	}{
+		{"D", FlowFormulaFormat{Type: FlowFormulaFormat_Date}, "yyyy-mm-dd"},
+		{"t", FlowFormulaFormat{Type: FlowFormulaFormat_Time}, "hh:mm:ss"},
+		{"dt", FlowFormulaFormat{Type: FlowFormulaFormat_DateTime}, "yyyy-mm-dd hh:mm:ss"},
+		{"D(dd/mm/yyyy)", FlowFormulaFormat{Type: FlowFormulaFormat_Date, Pattern: "dd/mm/yyyy"}, "dd/mm/yyyy"},
+		{"t(h:mm AM/PM)", FlowFormulaFormat{Type: FlowFormulaFormat_Time, Pattern: "h:mm AM/PM"}, "h:mm AM/PM"},
+	}
+	for _, test := range tests {
+		got := ParseFlowFormulaFormat(test.value)
+		if got != test.want {
+			t.Errorf("ParseFlowFormulaFormat(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+		if pattern := *got.GenerateFormatStr(); pattern != test.pattern {
+			t.Errorf("%q pattern = %q, want %q", test.value, pattern, test.pattern)
+		}
+	}
+}
+
+func TestSplitFormat(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{""}},
+		{".2f", []string{".2f"}},
+		{`.2f;fmt:"#,##0.00"`, []string{".2f", `fmt:"#,##0.00"`}},
+		{`fmt:"#,##0.00;[Red]-#,##0.00"`, []string{`fmt:"#,##0.00;[Red]-#,##0.00"`}},
+		{`fmt:"a\";b"`, []string{`fmt:"a\";b"`}},
+		{"d;fmt:`#,##0 \"USD\";x`", []string{"d", "fmt:`#,##0 \"USD\";x`"}},
+		{"D(yy;mm);fmt:x", []string{"D(yy;mm)", "fmt:x"}},
+	}
+	for _, test := range tests {
+		got := splitFormat(test.value, ';')
+		if len(got) != len(test.want) {
+			t.Errorf("splitFormat(%q) = %q, want %q", test.value, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("splitFormat(%q) = %q, want %q", test.value, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRawFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		class   string
+		pattern string
+	}{
+		{`{{V(.2f;fmt:"#,##0.00")|[js] x}}`, FlowFormulaFormat_Float, "#,##0.00"},
+		{`{{V(fmt:"#,##0.00;[Red]-#,##0.00")|[js] x}}`, FlowFormulaFormat_Auto, "#,##0.00;[Red]-#,##0.00"},
+		{"{{C(d;fmt:`#,##0 \"USD\"`)|[js] x}}", FlowFormulaFormat_Int, `#,##0 "USD"`},
+		{`{{C(fmt="0.0%")|[js] x}}`, FlowFormulaFormat_Auto, "0.0%"},
+	}
+	for _, test := range tests {
+		formula, err := ParseFlowFormula(test.value)
+		if err != nil {
+			t.Errorf("ParseFlowFormula(%q): %v", test.value, err)
+			continue
+		}
+		if formula.Format.Type != test.class || *formula.Format.GenerateFormatStr() != test.pattern {
+			t.Errorf("ParseFlowFormula(%q) = %s %q, want %s %q", test.value, formula.Format.Type, *formula.Format.GenerateFormatStr(), test.class, test.pattern)
+		}
+	}
+}
+
+func TestParseFormatErrors(t *testing.T) {
+	tests := []struct {
+		value string
+		err   error
+	}{
+		{`{{C(x)|[js] 1}}`, ErrUnknownFormat},
+		{`{{C(.2f;fmt)|[js] 1}}`, ErrUnknownOption},
+		{`{{C(.2f;size:3)|[js] 1}}`, ErrUnknownOption},
+	}
+	for _, test := range tests {
+		if _, err := ParseFlowFormula(test.value); !errors.Is(err, test.err) {
+			t.Errorf("ParseFlowFormula(%q) error = %v, want %v", test.value, err, test.err)
+		}
+	}
+	if formula, err := ParseFlowFormula("plain text"); formula != nil || err != nil {
+		t.Errorf("ParseFlowFormula(plain text) = %v, %v, want nil", formula, err)
+	}
+}
+
+func TestSplitFormula(t *testing.T) {
+	tests := []struct {
+		body string
+		want [4]string
+	}{
+		{"[js] x", [4]string{"", "", "", "[js] x"}},
+		{"V|[js] x", [4]string{"V", "", "", "[js] x"}},
+		{"T#sales(.2f)|[js] x", [4]string{"T", "sales", ".2f", "[js] x"}},
+		{"C(a;style=[js] f(x)||y)|[js] x || y", [4]string{"C", "", "a;style=[js] f(x)||y", "[js] x || y"}},
+		{`C(s;note=[js] ")|" + x)|[js] x`, [4]string{"C", "", `s;note=[js] ")|" + x`, "[js] x"}},
+		{"C()|[js] x", [4]string{"", "", "", "C()|[js] x"}},
+		{"C(s|[js] x", [4]string{"", "", "", "C(s|[js] x"}},
+		{"Cx", [4]string{"", "", "", "Cx"}},
+	}
+	for _, test := range tests {
+		direct, name, format, exp := splitFormula(test.body)
+		if got := [4]string{direct, name, format, exp}; got != test.want {
+			t.Errorf("splitFormula(%q) = %q, want %q", test.body, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrUnsupportedImage = errors.New("unsupported image")
+var ErrImageFile = errors.New("image files are not allowed")
+
+var imageExtensions = map[string]string{
+	"png":  ".png",
+	"jpeg": ".jpg",
+	"gif":  ".gif",
+}
+
+// loadImage reads the value of the img format, which is either the raw bytes,
+// a `data:` URI, a file path relative to the base directory, or a base64
+// string. A string is read as a file first, and decoded as base64 only if it
+// gives a picture, so a file name such as `logo` is never taken for base64.
+func loadImage(value any, opts Options) ([]byte, error) {
+	switch val := value.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		if strings.HasPrefix(val, "data:") {
+			if index := strings.Index(val, ","); index != -1 {
+				return base64.StdEncoding.DecodeString(val[index+1:])
+			}
+			return nil, ErrUnsupportedImage
+		}
+		fileErr := ErrImageFile
+		if !opts.NoFiles {
+			path := val
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(opts.BaseDir, path)
+			}
+			data, err := os.ReadFile(path)
+			if err == nil {
+				return data, nil
+			}
+			fileErr = err
+		}
+		if data, err := base64.StdEncoding.DecodeString(val); err == nil {
+			if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+				return data, nil
+			}
+		}
+		return nil, fileErr
+	}
+	return nil, ErrUnsupportedImage
+}
+
+// addImage anchors the picture at the cell. With fit set the picture is
+// shrunk into the cell or merged area, keeping its aspect ratio.
+func addImage(workbook *excelize.File, sheet string, cellName string, value any, fit bool, opts Options) error {
+	data, err := loadImage(value, opts)
+	if err != nil {
+		return err
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ErrUnsupportedImage
+	}
+	if err := workbook.SetCellValue(sheet, cellName, nil); err != nil {
+		return err
+	}
+	return workbook.AddPictureFromBytes(sheet, cellName, &excelize.Picture{
+		Extension: imageExtensions[format],
+		File:      data,
+		Format: &excelize.GraphicOptions{
+			AutoFit:         fit,
+			LockAspectRatio: true,
+		},
+	})
+}
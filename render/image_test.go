@@ -0,0 +1,82 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func pngBytes(t *testing.T) []byte {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestLoadImage(t *testing.T) {
+	data := pngBytes(t)
+	dir := t.TempDir()
+	for _, name := range []string{"logo.png", "logo"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	tests := []struct {
+		value any
+		opts  Options
+		err   error
+	}{
+		{data, Options{}, nil},
+		{encoded, Options{}, nil},
+		{"data:image/png;base64," + encoded, Options{}, nil},
+		{"logo.png", Options{BaseDir: dir}, nil},
+		{filepath.Join(dir, "logo.png"), Options{}, nil},
+		{"logo", Options{BaseDir: dir}, nil},
+		{"missing.png", Options{BaseDir: dir}, fs.ErrNotExist},
+		{"missing", Options{BaseDir: dir}, fs.ErrNotExist},
+		{"missing", Options{NoFiles: true}, ErrImageFile},
+		{"logo.png", Options{BaseDir: dir, NoFiles: true}, ErrImageFile},
+		{encoded, Options{NoFiles: true}, nil},
+		{"data:nothing", Options{}, ErrUnsupportedImage},
+		{42, Options{}, ErrUnsupportedImage},
+	}
+	for i, test := range tests {
+		got, err := loadImage(test.value, test.opts)
+		if !errors.Is(err, test.err) {
+			t.Errorf("#%d error = %v, want %v", i, err, test.err)
+			continue
+		}
+		if err == nil && !bytes.Equal(got, data) {
+			t.Errorf("#%d loaded %d bytes, want the png", i, len(got))
+		}
+	}
+}
+
+func TestAddImage(t *testing.T) {
+	workbook := excelize.NewFile()
+	workbook.SetCellStr("Sheet1", "B2", "template")
+	if err := addImage(workbook, "Sheet1", "B2", pngBytes(t), true, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	pictures, err := workbook.GetPictures("Sheet1", "B2")
+	if err != nil || len(pictures) != 1 || pictures[0].Extension != ".png" {
+		t.Errorf("pictures = %+v, %v", pictures, err)
+	}
+	if value, _ := workbook.GetCellValue("Sheet1", "B2"); value != "" {
+		t.Errorf("cell text %q is kept", value)
+	}
+	if err := addImage(workbook, "Sheet1", "C3", []byte("not an image"), false, Options{}); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("error = %v, want %v", err, ErrUnsupportedImage)
+	}
+}
@@ -0,0 +1,64 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"time"
+)
+
+var ErrTimeout = errors.New("evaluation timeout")
+var ErrBudgetExceeded = errors.New("render time budget exceeded")
+var ErrTooManyCells = errors.New("too many cells rendered by a formula")
+var ErrMemoryExceeded = errors.New("render memory limit exceeded")
+
+// Options limits the rendering of templates from untrusted authors, the zero
+// values mean no limit. Policy is how the errors of the cells are handled,
+// strict by default.
+type Options struct {
+	Timeout   time.Duration // time limit of each expression, only checked before the python ones
+	Budget    time.Duration // time limit of the whole rendering
+	MaxCells  int           // limit of rows x cols rendered by each formula or block
+	MaxMemory uint64        // limit of the heap in bytes, checked before each expression
+	Policy    string
+	BaseDir   string // directory the relative image paths are resolved from, the working directory if empty
+	NoFiles   bool   // refuse the image file paths, such as in sandbox
+}
+
+// prepare checks the budget and the memory, and sets the deadline of the next
+// evaluations.
+func (state *renderState) prepare(engine RenderEngine) error {
+	if state.opts.MaxMemory > 0 && heapSize() > state.opts.MaxMemory {
+		return ErrMemoryExceeded
+	}
+	deadline := time.Time{}
+	if state.opts.Budget > 0 {
+		deadline = state.start.Add(state.opts.Budget)
+		if !time.Now().Before(deadline) {
+			return ErrBudgetExceeded
+		}
+	}
+	if state.opts.Timeout > 0 {
+		if timeout := time.Now().Add(state.opts.Timeout); deadline.IsZero() || timeout.Before(deadline) {
+			deadline = timeout
+		}
+	}
+	engine.SetDeadline(deadline)
+	return nil
+}
+
+// heapSize is the memory taken by the live and not yet collected objects of
+// the whole process.
+func heapSize() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// checkCells checks the size rendered by a formula or a block.
+func (state *renderState) checkCells(rows int, cols int) error {
+	if state.opts.MaxCells > 0 && rows*cols > state.opts.MaxCells {
+		return fmt.Errorf("%w: %d x %d", ErrTooManyCells, rows, cols)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package render_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		cells map[string]string
+		opts  render.Options
+		want  error
+	}{
+		{"timeout", map[string]string{"A1": "{{[js] while (true) {}}}"}, render.Options{Timeout: 20 * time.Millisecond}, render.ErrTimeout},
+		{"note timeout", map[string]string{"A1": "{{C(a;note=[js] while (true) {})|[js] 1}}"}, render.Options{Timeout: 20 * time.Millisecond}, render.ErrTimeout},
+		{"style timeout", map[string]string{"A1": "{{C(a;style=[js] while (true) {})|[js] 1}}"}, render.Options{Timeout: 20 * time.Millisecond}, render.ErrTimeout},
+		{"budget", map[string]string{"A1": "{{[js] 1}}"}, render.Options{Budget: time.Nanosecond}, render.ErrBudgetExceeded},
+		{"memory", map[string]string{"A1": "{{[js] 1}}"}, render.Options{MaxMemory: 1}, render.ErrMemoryExceeded},
+		{"formula cells", map[string]string{"A1": "{{T|[js] [[1, 2, 3], [4, 5, 6]]}}"}, render.Options{MaxCells: 5}, render.ErrTooManyCells},
+		{"note cells", map[string]string{"A1": "{{V(a;note=[js] Array(10).fill('x'))|[js] [1]}}"}, render.Options{MaxCells: 5}, render.ErrTooManyCells},
+		{"block cells", map[string]string{
+			"A1": "{{#each [js] [1, 2, 3] as n}}",
+			"A2": "{{[js] n}}",
+			"B2": "x",
+			"A3": "{{/each}}",
+		}, render.Options{MaxCells: 5}, render.ErrTooManyCells},
+		{"sheet cells", map[string]string{
+			"A1": "{{#sheet [js] [1, 2, 3] as n}}",
+			"B2": "{{[js] n}}",
+		}, render.Options{MaxCells: 10}, render.ErrTooManyCells},
+	}
+	for _, test := range tests {
+		_, err := renderCells(t, test.cells, nil, test.opts)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	workbook, err := renderCells(t, map[string]string{
+		"A1": "{{#each [js] [1, 2] as n}}",
+		"A2": "{{V|[js] [n, n]}}",
+		"A3": "{{/each}}",
+	}, nil, render.Options{Timeout: time.Second, Budget: time.Minute, MaxCells: 4, MaxMemory: 1 << 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCells(t, workbook, "Sheet1", map[string]string{"A1": "1", "A2": "1", "A3": "2", "A4": "2"})
+}
@@ -0,0 +1,27 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FlowLink is the value of the link format, URL can be an external address
+// or a location inside the workbook such as `Sheet1!A1` or `#Sheet1!A1`.
+type FlowLink struct {
+	URL     string
+	Text    string
+	Tooltip string
+}
+
+var locationRegExp = regexp.MustCompile(`^(?:'(?:[^']|'')+'|[^\s!:/'"]+)!\$?[A-Z]{1,3}\$?\d+(?::\$?[A-Z]{1,3}\$?\d+)?$`)
+
+// target returns the link and link type for SetCellHyperLink.
+func (link FlowLink) target() (string, string) {
+	if strings.HasPrefix(link.URL, "#") {
+		return link.URL[1:], "Location"
+	}
+	if locationRegExp.MatchString(link.URL) {
+		return link.URL, "Location"
+	}
+	return link.URL, "External"
+}
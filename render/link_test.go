@@ -0,0 +1,23 @@
+package render
+
+import "testing"
+
+func TestLinkTarget(t *testing.T) {
+	tests := []struct {
+		url      string
+		link     string
+		linkType string
+	}{
+		{"https://example.com/a!B1", "https://example.com/a!B1", "External"},
+		{"mailto:a@example.com", "mailto:a@example.com", "External"},
+		{"Sheet1!A1", "Sheet1!A1", "Location"},
+		{"'My Sheet'!$A$1:B2", "'My Sheet'!$A$1:B2", "Location"},
+		{"#Sheet2!C3", "Sheet2!C3", "Location"},
+	}
+	for _, test := range tests {
+		link, linkType := FlowLink{URL: test.url}.target()
+		if link != test.link || linkType != test.linkType {
+			t.Errorf("target(%q) = %q %s, want %q %s", test.url, link, linkType, test.link, test.linkType)
+		}
+	}
+}
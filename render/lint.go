@@ -0,0 +1,206 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrMalformedCell = errors.New("malformed template cell")
+var ErrUnknownVariable = errors.New("unknown variable")
+
+// CodeName is a global name read by the code, at its first use.
+type CodeName struct {
+	Name   string
+	Line   int
+	Column int
+}
+
+// CodeInfo is what checking the code finds without running it.
+type CodeInfo struct {
+	Refs    []CodeName // global names read by the code, except the builtins of the engine
+	Defines []string   // global names declared by the code
+}
+
+// Checker is a RenderEngine which can check the code without running it.
+type Checker interface {
+	// Check compiles the expression, or the statements of a script.
+	Check(code string, script bool) (*CodeInfo, error)
+}
+
+// contextNames are bound by the rendering itself.
+var contextNames = []string{"cell", "sheet", "record"}
+
+type lintCode struct {
+	Sheet  string
+	Cell   string
+	Text   string
+	Code   string
+	Script bool
+}
+
+// Lint checks the template without rendering it, for malformed cells, unknown
+// formats and languages, and syntax errors. With names, the variables bound
+// before rendering such as the data, the references to unknown variables are
+// reported too. The names bound by the template itself, such as the names of
+// blocks, named areas and config variables, are known anywhere in the workbook.
+func Lint(workbook *excelize.File, engine RenderEngine, names []string) RenderErrors {
+	errs := RenderErrors{}
+	codes := []lintCode{}
+	known := map[string]bool{}
+	for _, name := range append(contextNames, names...) {
+		known[name] = true
+	}
+
+	for _, sheet := range workbook.GetSheetList() {
+		if sheet == ConfigSheet {
+			codes = append(codes, lintConfig(workbook, known)...)
+			continue
+		}
+		dim, err := workbook.GetSheetDimension(sheet)
+		if err != nil {
+			continue
+		}
+		area, err := NewArea(dim)
+		if err != nil {
+			continue
+		}
+		for currentRow := area.Top; currentRow <= area.Bottom; currentRow += 1 {
+			for currentCol := area.Left; currentCol <= area.Right; currentCol += 1 {
+				cellName, _ := excelize.CoordinatesToCellName(currentCol, currentRow)
+				value, ok := getCellText(workbook, sheet, cellName)
+				if !ok {
+					continue
+				}
+				add := func(code string) {
+					if code != "" {
+						codes = append(codes, lintCode{Sheet: sheet, Cell: cellName, Text: value, Code: code})
+					}
+				}
+				if block := TryParseSheetBlock(value); block != nil {
+					known[block.Name] = true
+					add(block.Code)
+					add(block.TitleCode)
+					continue
+				}
+				if block := TryParseEachBlock(value); block != nil {
+					known[block.Name] = true
+					add(block.Code)
+					continue
+				}
+				if IsEachBlockEnd(value) || TryParseChartBlock(value) != nil {
+					continue
+				}
+				if block := TryParseIfBlock(value); block != nil {
+					add(block.Code)
+					continue
+				}
+				formula, err := ParseFlowFormula(value)
+				if err != nil {
+					errs = append(errs, newRenderError(sheet, cellName, value, "", err))
+					continue
+				}
+				if formula != nil {
+					if formula.Name != "" {
+						known[formula.Name] = true
+					}
+					add(formula.Code)
+					add(formula.Note)
+					add(formula.Style)
+					continue
+				}
+				if text := strings.TrimSpace(value); strings.HasPrefix(text, "{{") && strings.HasSuffix(text, "}}") {
+					errs = append(errs, newRenderError(sheet, cellName, value, "", ErrMalformedCell))
+				}
+			}
+		}
+	}
+
+	checker, ok := engine.(Checker)
+	if !ok {
+		return sortErrors(workbook, errs)
+	}
+	type pendingRefs struct {
+		Code lintCode
+		Refs []CodeName
+	}
+	pending := []pendingRefs{}
+	for _, code := range codes {
+		info, err := checker.Check(code.Code, code.Script)
+		if err != nil {
+			errs = append(errs, newRenderError(code.Sheet, code.Cell, code.Text, code.Code, err))
+			continue
+		}
+		for _, name := range info.Defines {
+			known[name] = true
+		}
+		pending = append(pending, pendingRefs{Code: code, Refs: info.Refs})
+	}
+	if names == nil {
+		return sortErrors(workbook, errs)
+	}
+	for _, item := range pending {
+		for _, ref := range item.Refs {
+			if known[ref.Name] {
+				continue
+			}
+			err := newRenderError(item.Code.Sheet, item.Code.Cell, item.Code.Text, item.Code.Code, fmt.Errorf("%w: %s", ErrUnknownVariable, ref.Name))
+			err.Line, err.Column = ref.Line, ref.Column
+			errs = append(errs, err)
+		}
+	}
+	return sortErrors(workbook, errs)
+}
+
+// sortErrors orders the errors by sheet, row and column.
+func sortErrors(workbook *excelize.File, errs RenderErrors) RenderErrors {
+	sheets := map[string]int{}
+	for i, sheet := range workbook.GetSheetList() {
+		sheets[sheet] = i
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Sheet != errs[j].Sheet {
+			return sheets[errs[i].Sheet] < sheets[errs[j].Sheet]
+		}
+		colI, rowI, _ := excelize.CellNameToCoordinates(errs[i].Cell)
+		colJ, rowJ, _ := excelize.CellNameToCoordinates(errs[j].Cell)
+		if rowI != rowJ {
+			return rowI < rowJ
+		}
+		return colI < colJ
+	})
+	return errs
+}
+
+// lintConfig returns the scripts and expressions of the config sheet, and
+// marks its variables as known.
+func lintConfig(workbook *excelize.File, known map[string]bool) []lintCode {
+	rows, err := workbook.GetRows(ConfigSheet)
+	if err != nil {
+		return nil
+	}
+	codes := []lintCode{}
+	for r, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		key := strings.TrimSpace(row[0])
+		cellName, _ := excelize.CoordinatesToCellName(1, r+1)
+		if scriptRegExp.MatchString(key) {
+			codes = append(codes, lintCode{Sheet: ConfigSheet, Cell: cellName, Text: row[0], Code: key, Script: true})
+			continue
+		}
+		if key == "" || len(row) < 2 {
+			continue
+		}
+		known[key] = true
+		cellName, _ = excelize.CoordinatesToCellName(2, r+1)
+		if code := strings.TrimSpace(row[1]); scriptRegExp.MatchString(code) {
+			codes = append(codes, lintCode{Sheet: ConfigSheet, Cell: cellName, Text: row[1], Code: code})
+		}
+	}
+	return codes
+}
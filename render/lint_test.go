@@ -0,0 +1,66 @@
+package render_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/azurity/flow-table/render"
+	"github.com/azurity/flow-table/render/engine"
+)
+
+func TestLint(t *testing.T) {
+	workbook := newWorkbook(t, map[string]string{
+		"A1": "{{#each [js] data.items as item}}",
+		"B2": "{{[js] item.name + total}}",
+		"A3": "{{/each}}",
+		"A4": "{{V#prices|[py] data['prices']}}",
+		"B4": "{{[cel] prices.values.size() + rate}}",
+		"C4": "{{[js] missing + cell.row}}",
+		"A5": "{{C(x)|[js] 1}}",
+		"B5": "{{}}",
+		"C5": "{{[py] (1 +}}",
+		"A6": "{{[rb] 1}}",
+		"B6": "plain text",
+	})
+	if _, err := workbook.NewSheet(render.ConfigSheet); err != nil {
+		t.Fatal(err)
+	}
+	for cellName, value := range map[string]string{"A1": "[js] var total = 0", "A2": "rate", "B2": "[js] 1.5"} {
+		if err := workbook.SetCellStr(render.ConfigSheet, cellName, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errs := render.Lint(workbook, newEngines(t), []string{"data"})
+	want := []struct {
+		cell string
+		err  error
+		line int
+	}{
+		{"C4", render.ErrUnknownVariable, 1},
+		{"A5", render.ErrUnknownFormat, 0},
+		{"B5", render.ErrMalformedCell, 0},
+		{"C5", nil, 1},
+		{"A6", engine.ErrUnknownLang, 0},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors:\n%s", errs.Table())
+	}
+	for i, item := range want {
+		got := errs[i]
+		if got.Sheet != "Sheet1" || got.Cell != item.cell || got.Line != item.line || (item.err != nil && !errors.Is(got, item.err)) {
+			t.Errorf("#%d = %v at line %d, want %s %v at line %d", i, got, got.Line, item.cell, item.err, item.line)
+		}
+	}
+	if got := fmt.Sprint(errs[0].Err); got != render.ErrUnknownVariable.Error()+": missing" {
+		t.Errorf("unknown variable error = %q", got)
+	}
+	if errs[0].Column != 2 {
+		t.Errorf("missing at column %d, want 2", errs[0].Column)
+	}
+
+	// without the names bound before rendering, the variables are not checked
+	if errs := render.Lint(workbook, newEngines(t), nil); len(errs) != len(want)-1 {
+		t.Errorf("errors without names:\n%s", errs.Table())
+	}
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"math"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// namedArea is the final range rendered by a named formula.
+type namedArea struct {
+	Sheet  string
+	Area   *Area
+	Values any
+	bound  bool // whether the engine holds the current range
+}
+
+// namedValues lays out the rendered values as the formula returned them: a
+// single value, a list or a list of rows. Values which can't be bound, such as
+// NaN, are nil.
+func namedValues(data [][]any, direct int) any {
+	clean := func(value any) any {
+		if val, ok := value.(float64); ok && (math.IsNaN(val) || math.IsInf(val, 0)) {
+			return nil
+		}
+		return value
+	}
+	switch direct {
+	case FlowFormulaDirect_Cell:
+		return clean(data[0][0])
+	case FlowFormulaDirect_H:
+		ret := []any{}
+		for _, value := range data[0] {
+			ret = append(ret, clean(value))
+		}
+		return ret
+	case FlowFormulaDirect_V:
+		ret := []any{}
+		for _, row := range data {
+			ret = append(ret, clean(row[0]))
+		}
+		return ret
+	default:
+		ret := []any{}
+		for _, row := range data {
+			values := []any{}
+			for _, value := range row {
+				values = append(values, clean(value))
+			}
+			ret = append(ret, values)
+		}
+		return ret
+	}
+}
+
+// bindNames binds the named areas whose range changed since they were bound,
+// as `{values, range, sheet, rows, cols}`.
+func (state *renderState) bindNames(engine RenderEngine) error {
+	for name, named := range state.names {
+		if named.bound {
+			continue
+		}
+		area := named.Area
+		rangeRef := area.String()
+		if area.Left == area.Right && area.Top == area.Bottom {
+			rangeRef, _ = excelize.CoordinatesToCellName(area.Left, area.Top)
+		}
+		err := engine.SetData(name, map[string]any{
+			"values": named.Values,
+			"range":  rangeRef,
+			"sheet":  named.Sheet,
+			"rows":   area.Bottom - area.Top + 1,
+			"cols":   area.Right - area.Left + 1,
+		})
+		if err != nil {
+			return err
+		}
+		named.bound = true
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package render
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNamedValues(t *testing.T) {
+	tests := []struct {
+		data   [][]any
+		direct int
+		want   any
+	}{
+		{[][]any{{1.0}}, FlowFormulaDirect_Cell, 1.0},
+		{[][]any{{math.NaN()}}, FlowFormulaDirect_Cell, nil},
+		{[][]any{{1.0, "a", math.Inf(1)}}, FlowFormulaDirect_H, []any{1.0, "a", nil}},
+		{[][]any{{1.0}, {2.0}}, FlowFormulaDirect_V, []any{1.0, 2.0}},
+		{[][]any{{1.0, 2.0}, {3.0, nil}}, FlowFormulaDirect_Table, []any{[]any{1.0, 2.0}, []any{3.0, nil}}},
+	}
+	for i, test := range tests {
+		if got := namedValues(test.data, test.direct); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d namedValues = %v, want %v", i, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package render
+
+import (
+	"github.com/xuri/excelize/v2"
+)
+
+const noteAuthor = "flow-table"
+
+// noteFormula is the formula of the note expression, in the same direction.
+func noteFormula(formula *FlowFormula) *FlowFormula {
+	return &FlowFormula{
+		Direct: formula.Direct,
+		Format: FlowFormulaFormat{Type: FlowFormulaFormat_String},
+		Code:   formula.Note,
+	}
+}
+
+// addNotes attaches the comments to the rendered cells. A single note is
+// attached to every cell, empty notes are skipped.
+func addNotes(workbook *excelize.File, sheet string, col int, row int, rows int, cols int, notes [][]any, noteRows int, noteCols int) error {
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			noteR, noteC := r, c
+			if noteRows == 1 && noteCols == 1 {
+				noteR, noteC = 0, 0
+			}
+			if noteR >= noteRows || noteC >= noteCols {
+				continue
+			}
+			text, ok := notes[noteR][noteC].(string)
+			if !ok || text == "" {
+				continue
+			}
+			cellName, _ := excelize.CoordinatesToCellName(col+c, row+r)
+			if err := workbook.DeleteComment(sheet, cellName); err != nil {
+				return err
+			}
+			err := workbook.AddComment(sheet, excelize.Comment{
+				Author: noteAuthor,
+				Cell:   cellName,
+				Text:   text,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
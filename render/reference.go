@@ -0,0 +1,392 @@
+package render
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// expansion is the area filled by a formula from its anchor cell. Any range
+// which ends on the anchor is treated as referring to the expansion, and is
+// stretched over it. For the copies of a block, the anchor is the last row of
+// the first copy in any column, and the formulas of the copies are left as is.
+type expansion struct {
+	Sheet string
+	Col   int // 0 for a block
+	Row   int
+	Cols  int
+	Rows  int
+	Top   int // the first row of the copies of a block
+}
+
+var refRegExp = regexp.MustCompile(`((?:'(?:[^']|'')+'|[A-Za-z_][\w.]*)!)?(\$?[A-Z]{1,3}\$?\d+)(?::(\$?[A-Z]{1,3}\$?\d+))?`)
+var cellRefRegExp = regexp.MustCompile(`^(\$?)([A-Z]{1,3})(\$?)(\d+)$`)
+
+type cellRef struct {
+	Col    int
+	Row    int
+	AbsCol bool
+	AbsRow bool
+}
+
+func parseCellRef(value string) (*cellRef, bool) {
+	match := cellRefRegExp.FindStringSubmatch(value)
+	if match == nil {
+		return nil, false
+	}
+	col, err := excelize.ColumnNameToNumber(match[2])
+	if err != nil {
+		return nil, false
+	}
+	row, err := strconv.Atoi(match[4])
+	if err != nil {
+		return nil, false
+	}
+	return &cellRef{Col: col, Row: row, AbsCol: match[1] != "", AbsRow: match[3] != ""}, true
+}
+
+func (ref cellRef) String() string {
+	ret := ""
+	if ref.AbsCol {
+		ret += "$"
+	}
+	col, _ := excelize.ColumnNumberToName(ref.Col)
+	ret += col
+	if ref.AbsRow {
+		ret += "$"
+	}
+	return ret + strconv.Itoa(ref.Row)
+}
+
+func unquoteSheetName(value string) string {
+	if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
+
+type refMatch struct {
+	Sheet string // unquoted sheet name, empty if unqualified
+	From  *cellRef
+	To    *cellRef // nil if it is a single cell
+}
+
+func isRefChar(ch byte) bool {
+	return ch == '_' || ch == '.' || ch == '$' || ch == '!' || (ch >= '0' && ch <= '9') || (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z')
+}
+
+// replaceRefs rewrites each cell or range reference in text by fn, which
+// reports whether the reference is changed. Function names such as `LOG10(`
+// are skipped.
+func replaceRefs(text string, fn func(ref *refMatch) bool) string {
+	matches := refRegExp.FindAllStringSubmatchIndex(text, -1)
+	builder := strings.Builder{}
+	last := 0
+	for _, match := range matches {
+		if match[0] > 0 && isRefChar(text[match[0]-1]) {
+			continue
+		}
+		if match[1] < len(text) && (isRefChar(text[match[1]]) || text[match[1]] == '(') {
+			continue
+		}
+		ref := &refMatch{}
+		if match[2] >= 0 {
+			ref.Sheet = unquoteSheetName(text[match[2] : match[3]-1])
+		}
+		var ok bool
+		if ref.From, ok = parseCellRef(text[match[4]:match[5]]); !ok {
+			continue
+		}
+		if match[6] >= 0 {
+			if ref.To, ok = parseCellRef(text[match[6]:match[7]]); !ok {
+				continue
+			}
+		}
+		if !fn(ref) {
+			continue
+		}
+		builder.WriteString(text[last:match[4]])
+		builder.WriteString(ref.From.String())
+		if ref.To != nil {
+			builder.WriteString(":" + ref.To.String())
+		}
+		last = match[1]
+	}
+	builder.WriteString(text[last:])
+	return builder.String()
+}
+
+// replaceFormulaRefs is replaceRefs skipping the string literals in formula.
+func replaceFormulaRefs(formula string, fn func(ref *refMatch) bool) string {
+	parts := strings.Split(formula, `"`)
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = replaceRefs(parts[i], fn)
+	}
+	return strings.Join(parts, `"`)
+}
+
+// shiftFormula moves the relative references in formula by the offset, as
+// Excel does when the formula is copied.
+func shiftFormula(formula string, cols int, rows int) string {
+	shift := func(ref *cellRef) {
+		if !ref.AbsCol {
+			ref.Col += cols
+		}
+		if !ref.AbsRow {
+			ref.Row += rows
+		}
+	}
+	return replaceFormulaRefs(formula, func(ref *refMatch) bool {
+		shift(ref.From)
+		if ref.To != nil {
+			shift(ref.To)
+		}
+		return true
+	})
+}
+
+// stretchRange stretches the range in place, and reports whether it ends on the anchor.
+func (exp expansion) stretchRange(from *cellRef, to *cellRef) bool {
+	if (exp.Col > 0 && (from.Col > exp.Col || to.Col < exp.Col)) || from.Row > exp.Row || to.Row < exp.Row {
+		return false
+	}
+	stretched := false
+	if exp.Rows > 1 && to.Row == exp.Row {
+		to.Row += exp.Rows - 1
+		stretched = true
+	}
+	if exp.Cols > 1 && to.Col == exp.Col {
+		to.Col += exp.Cols - 1
+		stretched = true
+	}
+	return stretched
+}
+
+// stretcher returns the replaceRefs callback stretching the references, the
+// unqualified ones are treated as on the sheet. A single cell reference is
+// treated as a range only if single is set, such as in the sqref of
+// conditional formats.
+func (exp expansion) stretcher(sheet string, single bool) func(ref *refMatch) bool {
+	return func(ref *refMatch) bool {
+		refSheet := ref.Sheet
+		if refSheet == "" {
+			refSheet = sheet
+		}
+		if !strings.EqualFold(refSheet, exp.Sheet) {
+			return false
+		}
+		if ref.To == nil {
+			if !single {
+				return false
+			}
+			to := *ref.From
+			ref.To = &to
+		}
+		return exp.stretchRange(ref.From, ref.To)
+	}
+}
+
+func (exp expansion) stretchRefs(text string, sheet string, single bool) string {
+	return replaceRefs(text, exp.stretcher(sheet, single))
+}
+
+func (exp expansion) stretchFormula(formula string, sheet string) string {
+	return replaceFormulaRefs(formula, exp.stretcher(sheet, false))
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// formulaCells are the cells holding a formula of each sheet, collected once
+// per sheet and moved along with the rows and columns inserted and removed by
+// the rendering. A cell may still be listed once its formula is overwritten.
+type formulaCells map[string][]*cellRef
+
+// get returns the formula cells of the sheet, collected on first use.
+func (cells formulaCells) get(workbook *excelize.File, sheet string) ([]*cellRef, error) {
+	if list, ok := cells[sheet]; ok {
+		return list, nil
+	}
+	dim, err := workbook.GetSheetDimension(sheet)
+	if err != nil {
+		return nil, err
+	}
+	area, err := NewArea(dim)
+	if err != nil {
+		return nil, err
+	}
+	list := []*cellRef{}
+	for row := area.Top; row <= area.Bottom; row += 1 {
+		for col := area.Left; col <= area.Right; col += 1 {
+			cellName, _ := excelize.CoordinatesToCellName(col, row)
+			if formula, err := workbook.GetCellFormula(sheet, cellName); err == nil && formula != "" {
+				list = append(list, &cellRef{Col: col, Row: row})
+			}
+		}
+	}
+	cells[sheet] = list
+	return list, nil
+}
+
+// add tracks a formula written to the sheet, unless the sheet is not collected yet.
+func (cells formulaCells) add(sheet string, col int, row int) {
+	if list, ok := cells[sheet]; ok {
+		cells[sheet] = append(list, &cellRef{Col: col, Row: row})
+	}
+}
+
+// move shifts the cells at or after pos along the axis by count, a negative
+// count removes the cells from pos on.
+func (cells formulaCells) move(sheet string, axis func(cell *cellRef) *int, pos int, count int) {
+	list, ok := cells[sheet]
+	if !ok {
+		return
+	}
+	ret := []*cellRef{}
+	for _, cell := range list {
+		value := axis(cell)
+		if count < 0 && *value >= pos && *value < pos-count {
+			continue
+		}
+		if *value >= pos {
+			*value += count
+		}
+		ret = append(ret, cell)
+	}
+	cells[sheet] = ret
+}
+
+// moveRows tracks count rows inserted at row, or removed from row when negative.
+func (cells formulaCells) moveRows(sheet string, row int, count int) {
+	cells.move(sheet, func(cell *cellRef) *int { return &cell.Row }, row, count)
+}
+
+// moveCols tracks count columns inserted at col, or removed from col when negative.
+func (cells formulaCells) moveCols(sheet string, col int, count int) {
+	cells.move(sheet, func(cell *cellRef) *int { return &cell.Col }, col, count)
+}
+
+// expandBlock tracks the rows between start and end repeated count times by
+// expandBlock.
+func (cells formulaCells) expandBlock(sheet string, start int, end int, count int) {
+	list, ok := cells[sheet]
+	if !ok {
+		return
+	}
+	height := end - start - 1
+	copies := []*cellRef{}
+	for _, cell := range list {
+		if cell.Row > start && cell.Row < end {
+			for i := 0; i < count; i++ {
+				copies = append(copies, &cellRef{Col: cell.Col, Row: cell.Row - 1 + i*height})
+			}
+		}
+	}
+	cells.moveRows(sheet, start, start-end-1)
+	cells.moveRows(sheet, start, count*height)
+	cells[sheet] = append(cells[sheet], copies...)
+}
+
+// stretchReferences updates the formulas, conditional formats, data
+// validations, defined names and charts of the workbook which refer to the
+// range ending on the anchor.
+func stretchReferences(workbook *excelize.File, exp expansion, formulas formulaCells) error {
+	for _, sheet := range workbook.GetSheetList() {
+		cells, err := formulas.get(workbook, sheet)
+		if err != nil {
+			return err
+		}
+		for _, cell := range cells {
+			if exp.Col == 0 && sheet == exp.Sheet && cell.Row >= exp.Top && cell.Row < exp.Row+exp.Rows {
+				continue
+			}
+			cellName, _ := excelize.CoordinatesToCellName(cell.Col, cell.Row)
+			formula, err := workbook.GetCellFormula(sheet, cellName)
+			if err != nil || formula == "" {
+				continue
+			}
+			if stretched := exp.stretchFormula(formula, sheet); stretched != formula {
+				if err := workbook.SetCellFormula(sheet, cellName, stretched); err != nil {
+					return err
+				}
+			}
+		}
+
+		formats, err := workbook.GetConditionalFormats(sheet)
+		if err != nil {
+			return err
+		}
+		for sqref, opts := range formats {
+			if stretched := exp.stretchRefs(sqref, sheet, true); stretched != sqref {
+				if err := workbook.UnsetConditionalFormat(sheet, sqref); err != nil {
+					return err
+				}
+				if err := workbook.SetConditionalFormat(sheet, stretched, opts); err != nil {
+					return err
+				}
+			}
+		}
+
+		validations, err := workbook.GetDataValidations(sheet)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, dv := range validations {
+			sqref, formula1, formula2 := dv.Sqref, dv.Formula1, dv.Formula2
+			dv.Sqref = exp.stretchRefs(dv.Sqref, sheet, true)
+			dv.Formula1 = exp.stretchFormula(dv.Formula1, sheet)
+			dv.Formula2 = exp.stretchFormula(dv.Formula2, sheet)
+			changed = changed || sqref != dv.Sqref || formula1 != dv.Formula1 || formula2 != dv.Formula2
+		}
+		if changed {
+			if err := workbook.DeleteDataValidation(sheet); err != nil {
+				return err
+			}
+			for _, dv := range validations {
+				dv.Formula1 = xmlEscaper.Replace(dv.Formula1)
+				dv.Formula2 = xmlEscaper.Replace(dv.Formula2)
+				if err := workbook.AddDataValidation(sheet, dv); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, name := range workbook.GetDefinedName() {
+		stretched := exp.stretchFormula(name.RefersTo, "")
+		if stretched == name.RefersTo {
+			continue
+		}
+		if err := workbook.DeleteDefinedName(&name); err != nil {
+			return err
+		}
+		name.RefersTo = stretched
+		if err := workbook.SetDefinedName(&name); err != nil {
+			return err
+		}
+	}
+
+	stretchCharts(workbook, exp)
+	return nil
+}
+
+// stretchCharts rewrites the references of the chart parts, excelize has no
+// API to read the series of a chart back.
+func stretchCharts(workbook *excelize.File, exp expansion) {
+	workbook.Pkg.Range(func(key, value any) bool {
+		path, ok := key.(string)
+		if !ok || !strings.HasPrefix(path, "xl/charts/chart") {
+			return true
+		}
+		content, ok := value.([]byte)
+		if !ok {
+			return true
+		}
+		if stretched := exp.stretchRefs(string(content), "", false); stretched != string(content) {
+			workbook.Pkg.Store(path, []byte(stretched))
+		}
+		return true
+	})
+}
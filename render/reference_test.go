@@ -0,0 +1,100 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplaceRefs(t *testing.T) {
+	refs := []string{}
+	replaceRefs(`SUM(A1:B2)+LOG10(C3)+Sheet2!D4+'My ''Sheet'''!$E$5:F6+name_A1+A1B`, func(ref *refMatch) bool {
+		text := ref.Sheet + "|" + ref.From.String()
+		if ref.To != nil {
+			text += ":" + ref.To.String()
+		}
+		refs = append(refs, text)
+		return false
+	})
+	want := []string{"|A1:B2", "|C3", "Sheet2|D4", "My 'Sheet'|$E$5:F6"}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("refs = %q, want %q", refs, want)
+	}
+}
+
+func TestShiftFormula(t *testing.T) {
+	tests := []struct {
+		formula    string
+		cols, rows int
+		want       string
+	}{
+		{"B5*C5", 0, 1, "B6*C6"},
+		{"SUM($A$1:A1)", 0, 2, "SUM($A$1:A3)"},
+		{"$B5+B$5", 1, 1, "$B6+C$5"},
+		{`IF(A1="A1",Sheet2!A1,LOG10(A1))`, 1, 0, `IF(B1="A1",Sheet2!B1,LOG10(B1))`},
+	}
+	for _, test := range tests {
+		if got := shiftFormula(test.formula, test.cols, test.rows); got != test.want {
+			t.Errorf("shiftFormula(%q, %d, %d) = %q, want %q", test.formula, test.cols, test.rows, got, test.want)
+		}
+	}
+}
+
+func TestStretchFormula(t *testing.T) {
+	exp := expansion{Sheet: "Sheet1", Col: 2, Row: 5, Cols: 1, Rows: 4}
+	tests := []struct {
+		formula string
+		sheet   string
+		want    string
+	}{
+		{"SUM(B5:B5)", "Sheet1", "SUM(B5:B8)"},
+		{"SUM(B2:B5)+B5", "Sheet1", "SUM(B2:B8)+B5"},
+		{"SUM($B$5:$B$5)", "Sheet1", "SUM($B$5:$B$8)"},
+		{"SUM(B5:B6)", "Sheet1", "SUM(B5:B6)"},
+		{"SUM(B5:B5)", "Sheet2", "SUM(B5:B5)"},
+		{"SUM(Sheet1!B5:B5)", "Sheet2", "SUM(Sheet1!B5:B8)"},
+		{`COUNTIF(B5:B5,"B5:B5")`, "Sheet1", `COUNTIF(B5:B8,"B5:B5")`},
+	}
+	for _, test := range tests {
+		if got := exp.stretchFormula(test.formula, test.sheet); got != test.want {
+			t.Errorf("stretchFormula(%q) on %s = %q, want %q", test.formula, test.sheet, got, test.want)
+		}
+	}
+	if got := exp.stretchRefs("B5 D1:D2", "Sheet1", true); got != "B5:B8 D1:D2" {
+		t.Errorf("stretchRefs = %q", got)
+	}
+}
+
+func TestFormulaCellsMove(t *testing.T) {
+	cells := formulaCells{"Sheet1": {{Col: 1, Row: 1}, {Col: 1, Row: 3}, {Col: 2, Row: 4}, {Col: 1, Row: 6}}}
+	positions := func() [][2]int {
+		ret := [][2]int{}
+		for _, cell := range cells["Sheet1"] {
+			ret = append(ret, [2]int{cell.Col, cell.Row})
+		}
+		return ret
+	}
+
+	// the block between the rows 2 and 5 repeated 3 times
+	cells.expandBlock("Sheet1", 2, 5, 3)
+	want := [][2]int{{1, 1}, {1, 8}, {1, 2}, {1, 4}, {1, 6}, {2, 3}, {2, 5}, {2, 7}}
+	if got := positions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after expandBlock = %v, want %v", got, want)
+	}
+	cells.moveRows("Sheet1", 2, -2)
+	want = [][2]int{{1, 1}, {1, 6}, {1, 2}, {1, 4}, {2, 3}, {2, 5}}
+	if got := positions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after moveRows = %v, want %v", got, want)
+	}
+	cells.moveCols("Sheet1", 2, 2)
+	want = [][2]int{{1, 1}, {1, 6}, {1, 2}, {1, 4}, {4, 3}, {4, 5}}
+	if got := positions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after moveCols = %v, want %v", got, want)
+	}
+
+	// the sheets not collected yet are left to be collected
+	cells.add("Sheet2", 1, 1)
+	cells.moveRows("Sheet2", 1, 1)
+	if _, ok := cells["Sheet2"]; ok {
+		t.Error("Sheet2 is tracked before collected")
+	}
+}
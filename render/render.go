@@ -1,7 +1,10 @@
 package render
 
 import (
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -34,144 +37,656 @@ func NewArea(dim string) (*Area, error) {
 	}, nil
 }
 
+func (area Area) String() string {
+	topLeft, _ := excelize.CoordinatesToCellName(area.Left, area.Top)
+	bottomRight, _ := excelize.CoordinatesToCellName(area.Right, area.Bottom)
+	return topLeft + ":" + bottomRight
+}
+
 func (area Area) Contains(col int, row int) bool {
 	return col >= area.Left && col <= area.Right && row >= area.Top && row <= area.Bottom
 }
 
+// shiftRows moves the area by the rows inserted after row, or by the row
+// removed at row for negative count.
+func (area *Area) shiftRows(row int, count int) {
+	if area.Top > row {
+		area.Top += count
+	}
+	if area.Bottom > row || (count < 0 && area.Bottom == row) {
+		area.Bottom += count
+	}
+}
+
+// shiftCols is shiftRows for columns.
+func (area *Area) shiftCols(col int, count int) {
+	if area.Left > col {
+		area.Left += count
+	}
+	if area.Right > col || (count < 0 && area.Right == col) {
+		area.Right += count
+	}
+}
+
+// timeOfDay is the fraction of the day of the time, in UTC as the other times.
+func timeOfDay(value time.Time) float64 {
+	hour, min, sec := value.UTC().Clock()
+	return (float64(hour*3600+min*60+sec) + float64(value.Nanosecond())/1e9) / 86400
+}
+
+// renderState is shared by the sheets of a single rendering.
+type renderState struct {
+	opts     Options
+	start    time.Time
+	styles   *styleCache
+	names    map[string]*namedArea
+	errors   RenderErrors // the errors collected by the policy
+	sheet    sheetScope   // the sheet being rendered
+	formulas formulaCells
+}
+
 func Render(workbook *excelize.File, engine RenderEngine) error {
-	for _, sheet := range workbook.GetSheetList() {
+	return RenderWithOptions(workbook, engine, Options{})
+}
 
-		dim, err := workbook.GetSheetDimension(sheet)
-		if err != nil {
+func RenderWithOptions(workbook *excelize.File, engine RenderEngine, opts Options) error {
+	state := &renderState{
+		opts:     opts,
+		start:    time.Now(),
+		styles:   newStyleCache(),
+		names:    map[string]*namedArea{},
+		formulas: formulaCells{},
+	}
+	defer engine.SetDeadline(time.Time{})
+	if err := renderConfig(workbook, engine, state); err != nil {
+		return err
+	}
+	for _, sheet := range workbook.GetSheetList() {
+		if err := state.prepare(engine); err != nil {
 			return err
 		}
-		area, err := NewArea(dim)
+		scopes, err := expandSheet(workbook, sheet, engine, state)
 		if err != nil {
 			return err
 		}
+		for _, scope := range scopes {
+			state.sheet = scope
+			if scope.Name != "" {
+				if err := engine.SetData(scope.Name, scope.Value); err != nil {
+					return err
+				}
+			}
+			index, err := workbook.GetSheetIndex(scope.Sheet)
+			if err != nil {
+				return err
+			}
+			err = engine.SetData("sheet", map[string]any{
+				"name":   scope.Sheet,
+				"index":  index,
+				"params": scope.Value,
+			})
+			if err != nil {
+				return err
+			}
+			if err := renderSheet(workbook, scope.Sheet, engine, state); err != nil {
+				return err
+			}
+		}
+	}
+	if len(state.errors) > 0 {
+		return state.errors
+	}
+	return nil
+}
 
-		calcMergeArea := func() []*Area {
-			mergeCells, err := workbook.GetMergeCells(sheet)
+func renderSheet(workbook *excelize.File, sheet string, engine RenderEngine, state *renderState) error {
+	dim, err := workbook.GetSheetDimension(sheet)
+	if err != nil {
+		return err
+	}
+	area, err := NewArea(dim)
+	if err != nil {
+		return err
+	}
+
+	calcMergeArea := func() []*Area {
+		mergeCells, err := workbook.GetMergeCells(sheet)
+		if err != nil {
+			return nil
+		}
+		mergeAreas := []*Area{}
+		for _, mCell := range mergeCells {
+			area, err := NewArea(mCell.GetStartAxis() + ":" + mCell.GetEndAxis())
 			if err != nil {
 				return nil
 			}
-			mergeAreas := []*Area{}
-			for _, mCell := range mergeCells {
-				area, err := NewArea(mCell.GetStartAxis() + ":" + mCell.GetEndAxis())
-				if err != nil {
-					return nil
-				}
-				mergeAreas = append(mergeAreas, area)
+			mergeAreas = append(mergeAreas, area)
+		}
+		return mergeAreas
+	}
+
+	mergeAreas := calcMergeArea()
+
+	scopes := []*blockScope{}
+	type chartAt struct {
+		Cell  *Area
+		Text  string
+		Block *ChartBlock
+	}
+	charts := []chartAt{}
+	// shiftRows moves the tracked rows after row by count, negative count for removed rows.
+	shiftRows := func(row int, count int) {
+		area.Bottom += count
+		for _, scope := range scopes {
+			if scope.Top > row {
+				scope.Top += count
+			}
+			if scope.Bottom >= row {
+				scope.Bottom += count
+			}
+		}
+		for _, named := range state.names {
+			if named.Sheet == sheet {
+				named.Area.shiftRows(row, count)
+				named.bound = false
+			}
+		}
+		for _, chart := range charts {
+			chart.Cell.shiftRows(row, count)
+		}
+	}
+	shiftCols := func(col int, count int) {
+		area.Right += count
+		for _, named := range state.names {
+			if named.Sheet == sheet {
+				named.Area.shiftCols(col, count)
+				named.bound = false
 			}
-			return mergeAreas
 		}
+		for _, chart := range charts {
+			chart.Cell.shiftCols(col, count)
+		}
+	}
+
+	// bindContext binds the named areas and the cell being rendered before an evaluation.
+	bindContext := func(col int, row int) error {
+		if err := state.prepare(engine); err != nil {
+			return err
+		}
+		if err := state.bindNames(engine); err != nil {
+			return err
+		}
+		colName, _ := excelize.ColumnNumberToName(col)
+		return engine.SetData("cell", map[string]any{
+			"row":    row,
+			"col":    col,
+			"column": colName,
+			"name":   colName + strconv.Itoa(row),
+		})
+	}
+	// failCell handles the error of the cell by the policy and marks it.
+	failCell := func(cellErr *RenderError) error {
+		if err := state.fail(cellErr); err != nil {
+			return err
+		}
+		return state.markCell(workbook, cellErr)
+	}
+	// evalCell and calcCell bind the context of the cell and evaluate the code.
+	evalCell := func(col int, row int, code string) (any, error) {
+		if err := bindContext(col, row); err != nil {
+			return nil, err
+		}
+		return engine.Eval(code)
+	}
+	calcCell := func(col int, row int, formula *FlowFormula) ([][]any, int, int, error) {
+		if err := bindContext(col, row); err != nil {
+			return nil, 0, 0, err
+		}
+		rendered, rows, cols, err := engine.CalcValue(formula)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		return rendered, rows, cols, state.checkCells(rows, cols)
+	}
 
-		mergeAreas := calcMergeArea()
+	// unbind restores the variable of an ended block to the enclosing block
+	// or sheet of the same name at the row, or removes it.
+	unbind := func(name string, row int) error {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if scope := scopes[i]; scope.Name == name && scope.Top <= row && row <= scope.Bottom {
+				return engine.SetData(name, scope.Value)
+			}
+		}
+		if state.sheet.Name == name {
+			return engine.SetData(name, state.sheet.Value)
+		}
+		return engine.UnsetData(name)
+	}
 
-		for currentRow := area.Top; currentRow <= area.Bottom; currentRow += 1 {
-			for currentCol := area.Left; currentCol <= area.Right; currentCol += 1 {
-				inMerge := false
-				for _, mArea := range mergeAreas {
-					if mArea.Contains(currentCol, currentRow) {
-						inMerge = true
-						break
-					}
+rowLoop:
+	for currentRow := area.Top; currentRow <= area.Bottom; currentRow += 1 {
+		for _, scope := range scopes {
+			if scope.Bottom+1 == currentRow && scope.Bottom >= scope.Top {
+				if err := unbind(scope.Name, currentRow); err != nil {
+					return err
 				}
-				if inMerge {
-					continue
+			}
+		}
+		for _, scope := range scopes {
+			if scope.Top == currentRow && scope.Bottom >= scope.Top {
+				if err := engine.SetData(scope.Name, scope.Value); err != nil {
+					return err
 				}
+			}
+		}
+		for currentCol := area.Left; currentCol <= area.Right; currentCol += 1 {
+			cellName, _ := excelize.CoordinatesToCellName(currentCol, currentRow)
+			value, ok := getCellText(workbook, sheet, cellName)
+			if !ok {
+				continue
+			}
 
-				cellName, _ := excelize.CoordinatesToCellName(currentCol, currentRow)
-				cellType, _ := workbook.GetCellType(sheet, cellName)
+			if block := TryParseEachBlock(value); block != nil {
+				end, err := findBlockEnd(workbook, sheet, area, currentRow)
+				if err != nil {
+					// an unclosed block is left as is
+					if err := failCell(newRenderError(sheet, cellName, value, "", err)); err != nil {
+						return err
+					}
+					continue
+				}
+				height := end - currentRow - 1
+				items, err := evalCell(currentCol, currentRow, block.Code)
+				list, ok := items.([]any)
+				if !ok {
+					list = []any{items}
+				}
+				if err == nil {
+					err = state.checkCells(len(list)*height, area.Right-area.Left+1)
+				}
+				if err != nil {
+					// a failed block renders no rows, but keeps its marked first row under the lenient policy
+					if err := failCell(newRenderError(sheet, cellName, value, block.Code, err)); err != nil {
+						return err
+					}
+					if state.opts.Policy == ErrorPolicy_Lenient {
+						for row := end; row > currentRow; row-- {
+							if err := workbook.RemoveRow(sheet, row); err != nil {
+								return err
+							}
+						}
+						state.formulas.moveRows(sheet, currentRow+1, currentRow-end)
+						shiftRows(currentRow, currentRow-end)
+						mergeAreas = calcMergeArea()
+						continue rowLoop
+					}
+					list = []any{}
+				}
+				if err := expandBlock(workbook, sheet, currentRow, end, len(list)); err != nil {
+					return err
+				}
+				state.formulas.expandBlock(sheet, currentRow, end, len(list))
+				shiftRows(currentRow, len(list)*height-(end-currentRow+1))
+				if len(list) > 1 && height > 0 {
+					err := stretchReferences(workbook, expansion{
+						Sheet: sheet,
+						Row:   currentRow + height - 1,
+						Rows:  (len(list)-1)*height + 1,
+						Top:   currentRow,
+					}, state.formulas)
+					if err != nil {
+						return err
+					}
+				}
+				if height > 0 {
+					for i, item := range list {
+						scopes = append(scopes, &blockScope{
+							Top:    currentRow + i*height,
+							Bottom: currentRow + (i+1)*height - 1,
+							Name:   block.Name,
+							Value:  item,
+						})
+					}
+				}
+				mergeAreas = calcMergeArea()
+				currentRow -= 1
+				continue rowLoop
+			}
+			if IsEachBlockEnd(value) {
+				if err := failCell(newRenderError(sheet, cellName, value, "", ErrUnexpectedBlockEnd)); err != nil {
+					return err
+				}
+				continue
+			}
 
-				if cellType != excelize.CellTypeInlineString && cellType != excelize.CellTypeSharedString {
+			if block := TryParseIfBlock(value); block != nil {
+				cond, err := evalCell(currentCol, currentRow, block.Code)
+				if err != nil {
+					// a failed condition keeps its row or column
+					if err := failCell(newRenderError(sheet, cellName, value, block.Code, err)); err != nil {
+						return err
+					}
 					continue
 				}
-				value, _ := workbook.GetCellValue(sheet, cellName)
-				formula := TryParseFlowFormula(value)
-				if formula == nil {
+				if isTruthy(cond) {
+					if err := workbook.SetCellValue(sheet, cellName, nil); err != nil {
+						return err
+					}
+					continue
+				}
+				if block.Target == IfTarget_Col {
+					col, _ := excelize.ColumnNumberToName(currentCol)
+					if err := workbook.RemoveCol(sheet, col); err != nil {
+						return err
+					}
+					state.formulas.moveCols(sheet, currentCol, -1)
+					shiftCols(currentCol, -1)
+					mergeAreas = calcMergeArea()
+					currentCol -= 1
 					continue
 				}
+				if err := workbook.RemoveRow(sheet, currentRow); err != nil {
+					return err
+				}
+				state.formulas.moveRows(sheet, currentRow, -1)
+				shiftRows(currentRow, -1)
+				mergeAreas = calcMergeArea()
+				currentRow -= 1
+				continue rowLoop
+			}
 
-				rendered, rows, cols, err := engine.CalcValue(formula)
-				if err != nil {
+			inMerge := false
+			for _, mArea := range mergeAreas {
+				if mArea.Contains(currentCol, currentRow) {
+					inMerge = true
+					break
+				}
+			}
+			if inMerge {
+				continue
+			}
+
+			if block := TryParseChartBlock(value); block != nil {
+				if err := workbook.SetCellValue(sheet, cellName, nil); err != nil {
 					return err
 				}
+				charts = append(charts, chartAt{
+					Cell:  &Area{Left: currentCol, Top: currentRow, Right: currentCol, Bottom: currentRow},
+					Text:  value,
+					Block: block,
+				})
+				continue
+			}
 
-				if rows > 1 {
-					workbook.InsertRows(sheet, currentRow+1, rows-1)
+			formula, err := ParseFlowFormula(value)
+			if err != nil {
+				if err := failCell(newRenderError(sheet, cellName, value, "", err)); err != nil {
+					return err
 				}
-				if cols > 1 {
-					col, _ := excelize.ColumnNumberToName(currentCol + 1)
-					workbook.InsertCols(sheet, col, cols-1)
+				continue
+			}
+			if formula == nil {
+				continue
+			}
+
+			code := formula.Code
+			rendered, rows, cols, err := calcCell(currentCol, currentRow, formula)
+			if err != nil {
+				// a failed formula is left as is
+				if err := failCell(newRenderError(sheet, cellName, value, code, err)); err != nil {
+					return err
 				}
-				for r := 0; r < rows; r++ {
-					for c := 0; c < cols; c++ {
-						newCellName, _ := excelize.CoordinatesToCellName(currentCol+c, currentRow+r)
-						switch formula.Format.Type {
-						case FlowFormulaFormat_String:
-							if val, ok := rendered[r][c].(string); ok {
-								err := workbook.SetCellStr(sheet, newCellName, val)
-								if err != nil {
-									return err
-								}
+				continue
+			}
+			// the error of the note or style, marked once the cell is rendered
+			var failed *RenderError
+			cellStyles := unwrapStyles(rendered)
+			if formula.Style != "" {
+				styles, err := evalCell(currentCol, currentRow, formula.Style)
+				if err != nil {
+					failed = newRenderError(sheet, cellName, value, formula.Style, err)
+					if err := state.fail(failed); err != nil {
+						return err
+					}
+				}
+				exprStyles := shapeStyles(styles, formula.Direct, rows, cols)
+				for r, row := range cellStyles {
+					for c, style := range row {
+						if style != nil {
+							exprStyles[r][c] = style
+						}
+					}
+				}
+				cellStyles = exprStyles
+			}
+
+			if rows > 1 {
+				workbook.InsertRows(sheet, currentRow+1, rows-1)
+				state.formulas.moveRows(sheet, currentRow+1, rows-1)
+				shiftRows(currentRow, rows-1)
+			}
+			if cols > 1 {
+				col, _ := excelize.ColumnNumberToName(currentCol + 1)
+				workbook.InsertCols(sheet, col, cols-1)
+				state.formulas.moveCols(sheet, currentCol+1, cols-1)
+				shiftCols(currentCol, cols-1)
+			}
+			for r := 0; r < rows; r++ {
+				for c := 0; c < cols; c++ {
+					newCellName, _ := excelize.CoordinatesToCellName(currentCol+c, currentRow+r)
+					switch formula.Format.Type {
+					case FlowFormulaFormat_Auto:
+						var err error
+						switch val := rendered[r][c].(type) {
+						case nil:
+							err = workbook.SetCellValue(sheet, newCellName, nil)
+						case string:
+							err = workbook.SetCellStr(sheet, newCellName, val)
+						case bool:
+							err = workbook.SetCellBool(sheet, newCellName, val)
+						case float64:
+							if !math.IsNaN(val) && !math.IsInf(val, 0) {
+								err = workbook.SetCellFloat(sheet, newCellName, val, -1, 64)
 							}
-						case FlowFormulaFormat_Int:
-							if val, ok := rendered[r][c].(int); ok {
-								err := workbook.SetCellInt(sheet, newCellName, val)
-								if err != nil {
-									return err
-								}
+						}
+						if err != nil {
+							return err
+						}
+					case FlowFormulaFormat_String:
+						if val, ok := rendered[r][c].(string); ok {
+							err := workbook.SetCellStr(sheet, newCellName, val)
+							if err != nil {
+								return err
+							}
+						}
+					case FlowFormulaFormat_Formula:
+						if val, ok := rendered[r][c].(string); ok && val != "" {
+							// clear the template text, or it is kept as the cached value
+							err := workbook.SetCellValue(sheet, newCellName, nil)
+							if err != nil {
+								return err
+							}
+							err = workbook.SetCellFormula(sheet, newCellName, shiftFormula(strings.TrimPrefix(val, "="), c, r))
+							if err != nil {
+								return err
+							}
+							state.formulas.add(sheet, currentCol+c, currentRow+r)
+						}
+					case FlowFormulaFormat_Link:
+						if val, ok := rendered[r][c].(FlowLink); ok && val.URL != "" {
+							err := workbook.SetCellStr(sheet, newCellName, val.Text)
+							if err != nil {
+								return err
 							}
-						case FlowFormulaFormat_Float:
-							if val, ok := rendered[r][c].(float64); ok {
-								err := workbook.SetCellFloat(sheet, newCellName, val, formula.Format.Constraint, 64)
-								if err != nil {
+							link, linkType := val.target()
+							opts := excelize.HyperlinkOpts{Display: &val.Text}
+							if val.Tooltip != "" {
+								opts.Tooltip = &val.Tooltip
+							}
+							err = workbook.SetCellHyperLink(sheet, newCellName, link, linkType, opts)
+							if err != nil {
+								if err := failCell(newRenderError(sheet, newCellName, value, code, err)); err != nil {
 									return err
 								}
 							}
-						case FlowFormulaFormat_Percent:
-							if val, ok := rendered[r][c].(float64); ok {
-								constraint := formula.Format.Constraint
-								if constraint > 0 {
-									constraint += 2
-								}
-								err := workbook.SetCellFloat(sheet, newCellName, val, constraint, 64)
-								if err != nil {
+						}
+					case FlowFormulaFormat_Image:
+						if rendered[r][c] != nil {
+							err := addImage(workbook, sheet, newCellName, rendered[r][c], formula.Format.Fit, state.opts)
+							if err != nil {
+								if err := failCell(newRenderError(sheet, newCellName, value, code, err)); err != nil {
 									return err
 								}
 							}
 						}
+					case FlowFormulaFormat_Int:
+						if val, ok := rendered[r][c].(int); ok {
+							err := workbook.SetCellInt(sheet, newCellName, val)
+							if err != nil {
+								return err
+							}
+						}
+					case FlowFormulaFormat_Float:
+						if val, ok := rendered[r][c].(float64); ok {
+							err := workbook.SetCellFloat(sheet, newCellName, val, formula.Format.Constraint, 64)
+							if err != nil {
+								return err
+							}
+						}
+					case FlowFormulaFormat_Percent:
+						if val, ok := rendered[r][c].(float64); ok {
+							constraint := formula.Format.Constraint
+							if constraint > 0 {
+								constraint += 2
+							}
+							err := workbook.SetCellFloat(sheet, newCellName, val, constraint, 64)
+							if err != nil {
+								return err
+							}
+						}
+					case FlowFormulaFormat_Date, FlowFormulaFormat_DateTime:
+						if val, ok := rendered[r][c].(time.Time); ok {
+							err := workbook.SetCellValue(sheet, newCellName, val.UTC())
+							if err != nil {
+								return err
+							}
+						}
+					case FlowFormulaFormat_Time:
+						if val, ok := rendered[r][c].(time.Time); ok {
+							err := workbook.SetCellFloat(sheet, newCellName, timeOfDay(val), -1, 64)
+							if err != nil {
+								return err
+							}
+						}
 					}
 				}
+			}
 
-				styleId, err := workbook.GetCellStyle(sheet, cellName)
+			if formula.Note != "" {
+				notes, noteRows, noteCols, err := calcCell(currentCol, currentRow, noteFormula(formula))
+				if err == nil {
+					err = addNotes(workbook, sheet, currentCol, currentRow, rows, cols, notes, noteRows, noteCols)
+				}
 				if err != nil {
+					failed = newRenderError(sheet, cellName, value, formula.Note, err)
+					if err := state.fail(failed); err != nil {
+						return err
+					}
+				}
+			}
+
+			styleId, err := workbook.GetCellStyle(sheet, cellName)
+			if err != nil {
+				return err
+			}
+			numFmt := *formula.Format.GenerateFormatStr()
+			newStyle, err := state.styles.get(workbook, styleId, numFmt, nil)
+			if err != nil {
+				return err
+			}
+			areaCell, _ := excelize.CoordinatesToCellName(currentCol+cols-1, currentRow+rows-1)
+			workbook.SetCellStyle(sheet, cellName, areaCell, newStyle)
+			for r, row := range cellStyles {
+				for c, style := range row {
+					if style == nil {
+						continue
+					}
+					cellStyle, err := state.styles.get(workbook, styleId, numFmt, style)
+					if err != nil {
+						return err
+					}
+					styledCell, _ := excelize.CoordinatesToCellName(currentCol+c, currentRow+r)
+					workbook.SetCellStyle(sheet, styledCell, styledCell, cellStyle)
+				}
+			}
+			if failed != nil {
+				if err := state.markCell(workbook, failed); err != nil {
 					return err
 				}
-				style, err := workbook.GetStyle(styleId)
-				if err != nil {
+			}
+
+			if len(formula.Rules) > 0 {
+				opts := []excelize.ConditionalFormatOptions{}
+				for _, rule := range formula.Rules {
+					opts = append(opts, rule.options())
+				}
+				rangeRef := cellName
+				if rows > 1 || cols > 1 {
+					rangeRef += ":" + areaCell
+				}
+				if err := workbook.SetConditionalFormat(sheet, rangeRef, opts); err != nil {
+					if err := state.fail(newRenderError(sheet, cellName, value, "", err)); err != nil {
+						return err
+					}
+				}
+			}
+
+			if formula.Name != "" {
+				state.names[formula.Name] = &namedArea{
+					Sheet:  sheet,
+					Area:   &Area{Left: currentCol, Top: currentRow, Right: currentCol + cols - 1, Bottom: currentRow + rows - 1},
+					Values: namedValues(rendered, formula.Direct),
+				}
+			}
+			mergeAreas = calcMergeArea()
+
+			if rows > 1 || cols > 1 {
+				if err := workbook.SetSheetDimension(sheet, area.String()); err != nil {
 					return err
 				}
-				newStyle, err := workbook.NewStyle(&excelize.Style{
-					Border:        style.Border,
-					Fill:          style.Fill,
-					Font:          style.Font,
-					Alignment:     style.Alignment,
-					Protection:    style.Protection,
-					NumFmt:        0,
-					DecimalPlaces: style.DecimalPlaces,
-					CustomNumFmt:  formula.Format.GenerateFormatStr(),
-				})
+				err := stretchReferences(workbook, expansion{
+					Sheet: sheet,
+					Col:   currentCol,
+					Row:   currentRow,
+					Cols:  cols,
+					Rows:  rows,
+				}, state.formulas)
 				if err != nil {
 					return err
 				}
-				areaCell, _ := excelize.CoordinatesToCellName(currentCol+cols-1, currentRow+rows-1)
-				workbook.SetCellStyle(sheet, cellName, areaCell, newStyle)
-
-				area.Right += cols - 1
-				area.Bottom += rows - 1
-				mergeAreas = calcMergeArea()
+			}
+		}
+	}
+	// a sheet whose rows or columns are all removed is left empty
+	dim = "A1"
+	if area.Bottom >= area.Top && area.Right >= area.Left {
+		dim = area.String()
+	}
+	if err := workbook.SetSheetDimension(sheet, dim); err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if scope.Bottom >= area.Bottom && scope.Bottom >= scope.Top {
+			if err := unbind(scope.Name, area.Bottom+1); err != nil {
+				return err
+			}
+		}
+	}
+	for _, chart := range charts {
+		cellName, _ := excelize.CoordinatesToCellName(chart.Cell.Left, chart.Cell.Top)
+		if err := addChart(workbook, sheet, cellName, chart.Block, state.names); err != nil {
+			if err := state.fail(newRenderError(sheet, cellName, chart.Text, "", err)); err != nil {
+				return err
 			}
 		}
 	}
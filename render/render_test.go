@@ -0,0 +1,519 @@
+package render_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azurity/flow-table/render"
+	"github.com/azurity/flow-table/render/engine"
+	"github.com/xuri/excelize/v2"
+)
+
+func newEngines(t *testing.T) *engine.MultiEngine {
+	t.Helper()
+	celEngine, err := engine.NewCelEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine.NewMultiEngine(map[string]render.RenderEngine{
+		"js":  engine.NewJsEngine(),
+		"py":  engine.NewPyEngine(),
+		"cel": celEngine,
+	}, map[string]string{})
+}
+
+// newWorkbook creates a workbook with the cells of Sheet1, a text starting
+// with = is written as a formula.
+func newWorkbook(t *testing.T, cells map[string]string) *excelize.File {
+	t.Helper()
+	workbook := excelize.NewFile()
+	area := &render.Area{Left: 1, Top: 1, Right: 1, Bottom: 1}
+	for cellName, text := range cells {
+		var err error
+		if strings.HasPrefix(text, "=") {
+			err = workbook.SetCellFormula("Sheet1", cellName, text[1:])
+		} else {
+			err = workbook.SetCellStr("Sheet1", cellName, text)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		col, row, _ := excelize.CellNameToCoordinates(cellName)
+		if col > area.Right {
+			area.Right = col
+		}
+		if row > area.Bottom {
+			area.Bottom = row
+		}
+	}
+	if err := workbook.SetSheetDimension("Sheet1", area.String()); err != nil {
+		t.Fatal(err)
+	}
+	return workbook
+}
+
+// renderCells renders the cells of Sheet1 with the data.
+func renderCells(t *testing.T, cells map[string]string, data map[string]any, opts render.Options) (*excelize.File, error) {
+	t.Helper()
+	workbook := newWorkbook(t, cells)
+	engines := newEngines(t)
+	if err := engines.InitData(data); err != nil {
+		t.Fatal(err)
+	}
+	return workbook, render.RenderWithOptions(workbook, engines, opts)
+}
+
+func mustRender(t *testing.T, cells map[string]string, data map[string]any) *excelize.File {
+	t.Helper()
+	workbook, err := renderCells(t, cells, data, render.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return workbook
+}
+
+// expectCells checks the formatted values of the cells of the sheet.
+func expectCells(t *testing.T, workbook *excelize.File, sheet string, want map[string]string) {
+	t.Helper()
+	for cellName, value := range want {
+		got, err := workbook.GetCellValue(sheet, cellName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != value {
+			t.Errorf("%s!%s = %q, want %q", sheet, cellName, got, value)
+		}
+	}
+}
+
+func TestTimeFormats(t *testing.T) {
+	// the times are written in UTC whatever the local zone is
+	local := time.Local
+	time.Local = time.FixedZone("UTC+9", 9*60*60)
+	defer func() {
+		time.Local = local
+	}()
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{C(D)|[js] new Date(Date.UTC(2024, 0, 2, 3, 4, 5))}}`,
+		"A2": `{{C(t)|[js] new Date(Date.UTC(2024, 0, 2, 3, 4, 5))}}`,
+		"A3": `{{C(dt)|[js] new Date(Date.UTC(2024, 0, 2, 3, 4, 5))}}`,
+		"A4": `{{C(D(dd/mm/yyyy))|[js] new Date(Date.UTC(2024, 0, 2))}}`,
+		"A5": `{{C(dt)|[js] "2024-01-02 03:04:05"}}`,
+		"A6": `{{C(t)|[py] "2024-01-02T03:04:05+01:00"}}`,
+		"A7": `{{C(dt)|[cel] timestamp("2024-01-02T03:04:05Z")}}`,
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"A1": "2024-01-02",
+		"A2": "03:04:05",
+		"A3": "2024-01-02 03:04:05",
+		"A4": "02/01/2024",
+		"A5": "2024-01-02 03:04:05",
+		"A6": "02:04:05",
+		"A7": "2024-01-02 03:04:05",
+	})
+}
+
+func TestRawNumberFormat(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{C(.2f;fmt:"#,##0.00")|[js] 1234.5}}`,
+		"A2": "{{C(d;fmt:`0 \"USD\"`)|[js] 12}}",
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"A1": "1,234.50",
+		"A2": "12 USD",
+	})
+}
+
+func TestAutoFormat(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    map[string]string
+	}{
+		{`{{H(a)|[js] ["x", 1.5, true, null, NaN]}}`, map[string]string{"A1": "x", "B1": "1.5", "C1": "TRUE", "D1": "", "E1": ""}},
+		{`{{H|[py] ["y", 2, False, None]}}`, map[string]string{"A1": "y", "B1": "2", "C1": "FALSE", "D1": ""}},
+		{`{{H|[cel] ["z", 3.25, true, null]}}`, map[string]string{"A1": "z", "B1": "3.25", "C1": "TRUE", "D1": ""}},
+	}
+	for _, test := range tests {
+		workbook := mustRender(t, map[string]string{"A1": test.formula}, nil)
+		expectCells(t, workbook, "Sheet1", test.want)
+		types := map[string]excelize.CellType{
+			"A1": excelize.CellTypeSharedString,
+			"B1": excelize.CellTypeUnset,
+			"C1": excelize.CellTypeBool,
+		}
+		for cellName, want := range types {
+			if got, _ := workbook.GetCellType("Sheet1", cellName); got != want {
+				t.Errorf("%s: type of %s = %v, want %v", test.formula, cellName, got, want)
+			}
+		}
+	}
+}
+
+func TestStretchReferences(t *testing.T) {
+	workbook := newWorkbook(t, map[string]string{
+		"B2": "{{V|[js] [1, 2, 3, 4]}}",
+		"B3": "=SUM(B2:B2)+COUNT($B$2:$B$2)+B2",
+		"C3": `=IF(A1="B2:B2",SUM(A2:B2),0)`,
+	})
+	if _, err := workbook.NewSheet("Other"); err != nil {
+		t.Fatal(err)
+	}
+	workbook.SetCellFormula("Other", "A1", "SUM(Sheet1!B2:B2)+SUM(B2:B2)")
+	workbook.SetDefinedName(&excelize.DefinedName{Name: "vals", RefersTo: "Sheet1!$B$2:$B$2"})
+	workbook.AddDataValidation("Sheet1", &excelize.DataValidation{Sqref: "B2", Type: "decimal", Operator: "between", Formula1: "0", Formula2: "10"})
+	workbook.SetConditionalFormat("Sheet1", "B2:B2", []excelize.ConditionalFormatOptions{{Type: "cell", Criteria: ">", Value: "2"}})
+	err := workbook.AddChart("Sheet1", "E2", &excelize.Chart{
+		Type:   excelize.Line,
+		Series: []excelize.ChartSeries{{Name: "x", Values: "Sheet1!$B$2:$B$2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := render.Render(workbook, newEngines(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	formulas := map[string]string{
+		"Sheet1!B6": "SUM(B2:B5)+COUNT($B$2:$B$5)+B2",
+		"Sheet1!C6": `IF(A1="B2:B2",SUM(A2:B5),0)`,
+		"Other!A1":  "SUM(Sheet1!B2:B5)+SUM(B2:B2)",
+	}
+	for ref, want := range formulas {
+		sheet, cellName, _ := strings.Cut(ref, "!")
+		if got, _ := workbook.GetCellFormula(sheet, cellName); got != want {
+			t.Errorf("%s = %q, want %q", ref, got, want)
+		}
+	}
+	if names := workbook.GetDefinedName(); len(names) != 1 || names[0].RefersTo != "Sheet1!$B$2:$B$5" {
+		t.Errorf("defined names = %+v", names)
+	}
+	if validations, _ := workbook.GetDataValidations("Sheet1"); len(validations) != 1 || validations[0].Sqref != "B2:B5" {
+		t.Errorf("data validations = %+v", validations)
+	}
+	if formats, _ := workbook.GetConditionalFormats("Sheet1"); formats["B2:B5"] == nil {
+		t.Errorf("conditional formats = %v", formats)
+	}
+	chart, ok := workbook.Pkg.Load("xl/charts/chart1.xml")
+	if !ok || !strings.Contains(string(chart.([]byte)), "Sheet1!$B$2:$B$5") || strings.Contains(string(chart.([]byte)), "Sheet1!$B$2:$B$2") {
+		t.Errorf("chart series not stretched: %s", chart)
+	}
+}
+
+func TestFormulaFormat(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{V(=)|[js] ["B1*2", "=B1*2", "", "SUM($B$1:B1)"]}}`,
+	}, nil)
+	want := map[string]string{"A1": "B1*2", "A2": "B2*2", "A3": "", "A4": "SUM($B$1:B4)"}
+	for cellName, formula := range want {
+		if got, _ := workbook.GetCellFormula("Sheet1", cellName); got != formula {
+			t.Errorf("formula of %s = %q, want %q", cellName, got, formula)
+		}
+	}
+	expectCells(t, workbook, "Sheet1", map[string]string{"A3": ""})
+}
+
+func TestLinkFormat(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{V(link)|[js] ["https://example.com", {url: "#Sheet1!B2", text: "go", tooltip: "tip"}, {url: ""}]}}`,
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{"A1": "https://example.com", "A2": "go", "A3": ""})
+	tests := []struct {
+		cellName string
+		target   string
+	}{
+		{"A1", "https://example.com"},
+		{"A2", "Sheet1!B2"},
+	}
+	for _, test := range tests {
+		ok, target, err := workbook.GetCellHyperLink("Sheet1", test.cellName)
+		if err != nil || !ok || target != test.target {
+			t.Errorf("link of %s = %v %q %v, want %q", test.cellName, ok, target, err, test.target)
+		}
+	}
+	if ok, _, _ := workbook.GetCellHyperLink("Sheet1", "A3"); ok {
+		t.Error("empty url is linked")
+	}
+}
+
+// comments returns the comment text of each cell of the sheet.
+func comments(t *testing.T, workbook *excelize.File, sheet string) map[string]string {
+	t.Helper()
+	list, err := workbook.GetComments(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := map[string]string{}
+	for _, comment := range list {
+		ret[comment.Cell] = comment.Text
+	}
+	return ret
+}
+
+func TestNotes(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{V(a;note:[js] ["first", "", "third"])|[js] [1, 2, 3]}}`,
+		"B1": `{{H(a;note:[py] "same")|[py] [1, 2]}}`,
+	}, nil)
+	want := map[string]string{"A1": "first", "A3": "third", "B1": "same", "C1": "same"}
+	if got := comments(t, workbook, "Sheet1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("comments = %v, want %v", got, want)
+	}
+}
+
+func TestDynamicStyles(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{V(a;style:[js] [{bold: true}, null])|[js] [1, {value: 2, style: {fill: "#FF0000"}}]}}`,
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{"A1": "1", "A2": "2"})
+	styleOf := func(cellName string) *excelize.Style {
+		id, _ := workbook.GetCellStyle("Sheet1", cellName)
+		style, err := workbook.GetStyle(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return style
+	}
+	if style := styleOf("A1"); style.Font == nil || !style.Font.Bold {
+		t.Errorf("A1 is not bold: %+v", style.Font)
+	}
+	if style := styleOf("A2"); len(style.Fill.Color) != 1 || style.Fill.Color[0] != "FF0000" {
+		t.Errorf("A2 fill = %+v", style.Fill)
+	}
+}
+
+func TestConditionalFormatRules(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{V(a;cf:databar(#638EC6);cf:iconset(3Arrows))|[js] [1, 2, 3]}}`,
+		"B1": `{{C(a;cf:colorscale)|[js] 4}}`,
+	}, nil)
+	formats, err := workbook.GetConditionalFormats("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string][]string{}
+	for sqref, opts := range formats {
+		for _, opt := range opts {
+			types[sqref] = append(types[sqref], opt.Type)
+		}
+	}
+	want := map[string][]string{"A1:A3": {"data_bar", "icon_set"}, "B1": {"3_color_scale"}}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("conditional formats = %v, want %v", types, want)
+	}
+}
+
+func TestChart(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{V#sales|[js] [10, 20, 30]}}`,
+		"C1": `{{chart(type=col, data=@sales, categories=B1:B3, title="Sales")}}`,
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{"C1": ""})
+	chart, ok := workbook.Pkg.Load("xl/charts/chart1.xml")
+	if !ok {
+		t.Fatal("no chart added")
+	}
+	for _, ref := range []string{"!$A$1:$A$3", "!$B$1:$B$3"} {
+		if !strings.Contains(string(chart.([]byte)), ref) {
+			t.Errorf("chart doesn't refer to %s", ref)
+		}
+	}
+}
+
+func TestEmptySheet(t *testing.T) {
+	for _, cells := range []map[string]string{
+		{"A1": "{{#each [js] [] as x}}", "A2": "{{[js] x}}", "A3": "{{/each}}"},
+		{"A1": "{{if [js] false}}"},
+		{"A1": "=1", "B1": "{{if [js] false}}"},
+		{"A1": "{{if col [js] false}}"},
+	} {
+		workbook := mustRender(t, cells, nil)
+		if dim, err := workbook.GetSheetDimension("Sheet1"); err != nil || dim != "A1" {
+			t.Errorf("%v: dimension = %q, %v, want A1", cells, dim, err)
+		}
+	}
+}
+
+func TestNamedAreas(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": `{{V#prices|[js] [10, 20, 30]}}`,
+		"A2": `{{[js] prices.values.reduce((a, b) => a + b)}}`,
+		"B2": `{{[py] prices["range"] + " " + prices["sheet"]}}`,
+		"C2": `{{[cel] string(prices.rows) + "x" + string(prices.cols)}}`,
+		"A3": `{{C#total|[js] 6}}`,
+		"A4": `{{[js] "=SUM(" + prices.range + ")*" + total.values}}`,
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"A4": "60",
+		"B4": "A1:A3 Sheet1",
+		"C4": "3x1",
+		"A6": "=SUM(A1:A3)*6",
+	})
+}
+
+func TestCellContext(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{#each [js] [1, 2] as n}}",
+		"B2": `{{[js] cell.name + ":" + cell.row + ":" + cell.col}}`,
+		"C2": `{{[py] cell["column"] + str(n)}}`,
+		"A3": "{{/each}}",
+		"A4": `{{[cel] sheet.name + ":" + string(sheet.index)}}`,
+		"B4": `{{[js] sheet.params === null}}`,
+	}, nil)
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"B1": "B1:1:2",
+		"C1": "C1",
+		"B2": "B2:2:2",
+		"C2": "C2",
+		"A3": "Sheet1:0",
+		"B3": "TRUE",
+	})
+
+	workbook = mustRender(t, map[string]string{
+		"A1": "{{#sheet [js] [{id: 7}] as p named [js] 'P' + p.id}}",
+		"A2": "{{[js] sheet.params.id}}",
+	}, nil)
+	expectCells(t, workbook, "P7", map[string]string{"A2": "7"})
+}
+
+func TestErrorLocation(t *testing.T) {
+	tests := []struct {
+		cells  map[string]string
+		cell   string
+		engine string
+		line   int
+	}{
+		{map[string]string{"A1": "{{[js] 1}}", "B3": "{{[js] let a = 1; missing.value}}"}, "B3", "js", 1},
+		{map[string]string{"C2": "{{[py] 1 +}}"}, "C2", "py", 1},
+		{map[string]string{"A1": "{{[cel] 1 +}}"}, "A1", "cel", 1},
+		{map[string]string{"A1": "{{[rb] 1}}"}, "A1", "rb", 0},
+	}
+	for _, test := range tests {
+		_, err := renderCells(t, test.cells, nil, render.Options{})
+		var renderErr *render.RenderError
+		if !errors.As(err, &renderErr) {
+			t.Errorf("error = %v, want a RenderError", err)
+			continue
+		}
+		if renderErr.Sheet != "Sheet1" || renderErr.Cell != test.cell || renderErr.Engine != test.engine || renderErr.Line != test.line {
+			t.Errorf("error at %s!%s [%s] %d, want Sheet1!%s [%s] %d", renderErr.Sheet, renderErr.Cell, renderErr.Engine, renderErr.Line, test.cell, test.engine, test.line)
+		}
+	}
+}
+
+func TestCollectPolicy(t *testing.T) {
+	workbook, err := renderCells(t, map[string]string{
+		"A1": "{{[js] missing}}",
+		"B1": "{{[js] 1 + 1}}",
+		"A2": "{{(unknown)|[js] 1}}",
+		"B2": "{{[py] missing}}",
+		"A3": "{{/each}}",
+		"B3": "{{C(x)|[js] 1}}",
+		"C3": "{{C(.2f;bogus=1)|[js] 1}}",
+	}, nil, render.Options{Policy: render.ErrorPolicy_Collect})
+	var errs render.RenderErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error = %v, want RenderErrors", err)
+	}
+	failed := map[string]error{}
+	for _, cellErr := range errs {
+		failed[cellErr.Cell] = cellErr
+	}
+	want := map[string]error{
+		"A1": nil,
+		"A2": engine.ErrWrongCodeFormat,
+		"B2": nil,
+		"A3": render.ErrUnexpectedBlockEnd,
+		"B3": render.ErrUnknownFormat,
+		"C3": render.ErrUnknownOption,
+	}
+	if len(failed) != len(want) {
+		t.Errorf("failed cells:\n%s", errs.Table())
+	}
+	for cellName, wantErr := range want {
+		if err, ok := failed[cellName]; !ok || (wantErr != nil && !errors.Is(err, wantErr)) {
+			t.Errorf("%s: error = %v, want %v", cellName, err, wantErr)
+		}
+	}
+	expectCells(t, workbook, "Sheet1", map[string]string{"B1": "2", "B3": "{{C(x)|[js] 1}}"})
+}
+
+func TestLenientPolicy(t *testing.T) {
+	workbook, err := renderCells(t, map[string]string{
+		"A1": "{{#each [js] missingList as x}}",
+		"A2": "{{[js] x}}",
+		"A3": "{{/each}}",
+		"A4": `{{[js] "after"}}`,
+		"A5": "{{[js] missingValue}}",
+		"A6": `{{C(img)|[js] "logo.png"}}`,
+		"B6": "{{C(x)|[js] 1}}",
+	}, nil, render.Options{Policy: render.ErrorPolicy_Lenient, NoFiles: true})
+	var errs render.RenderErrors
+	if !errors.As(err, &errs) || len(errs) != 4 {
+		t.Fatalf("error = %v, want 4 RenderErrors", err)
+	}
+	expectCells(t, workbook, "Sheet1", map[string]string{
+		"A1": "#FLOW!",
+		"A2": "after",
+		"A3": "#FLOW!",
+		"A4": "#FLOW!",
+		"B4": "#FLOW!",
+		"A5": "",
+	})
+	notes := comments(t, workbook, "Sheet1")
+	for cellName, text := range map[string]string{"A1": "missingList", "A3": "missingValue", "A4": render.ErrImageFile.Error(), "B4": render.ErrUnknownFormat.Error()} {
+		if !strings.Contains(notes[cellName], text) {
+			t.Errorf("comment of %s = %q, want it to hold %q", cellName, notes[cellName], text)
+		}
+	}
+	styleId, err := workbook.GetCellStyle("Sheet1", "A3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	style, err := workbook.GetStyle(styleId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(style.Fill.Color) != 1 || !strings.EqualFold(style.Fill.Color[0], "FFC7CE") {
+		t.Errorf("fill of the marker = %v", style.Fill.Color)
+	}
+}
+
+func TestLenientPolicyStops(t *testing.T) {
+	_, err := renderCells(t, map[string]string{"A1": "{{[js] 1}}"}, nil, render.Options{Policy: render.ErrorPolicy_Lenient, Budget: time.Nanosecond})
+	if !errors.Is(err, render.ErrBudgetExceeded) {
+		t.Errorf("error = %v, want %v", err, render.ErrBudgetExceeded)
+	}
+}
+
+func TestStretchBlockReferences(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{#each [js] [1, 2, 3] as n}}",
+		"B2": "{{[js] n}}",
+		"C2": "=SUM(B2:B2)",
+		"A3": "{{/each}}",
+		"B5": "=SUM(B2:B2)",
+		"B6": "=B2",
+	}, nil)
+	for cellName, want := range map[string]string{
+		"C1": "SUM(B1:B1)",
+		"C3": "SUM(B3:B3)",
+		"B5": "SUM(B1:B3)",
+		"B6": "B1",
+	} {
+		if got, _ := workbook.GetCellFormula("Sheet1", cellName); got != want {
+			t.Errorf("%s = %q, want %q", cellName, got, want)
+		}
+	}
+}
+
+func TestContextReplacesData(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{[js] cell.name + sheet.name}}",
+		"B1": `{{[py] cell["name"] + sheet["name"]}}`,
+		"C1": "{{[cel] cell.name + sheet.name}}",
+	}, map[string]any{"cell": "data", "sheet": "data"})
+	expectCells(t, workbook, "Sheet1", map[string]string{"A1": "A1Sheet1", "B1": "B1Sheet1", "C1": "C1Sheet1"})
+}
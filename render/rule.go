@@ -0,0 +1,83 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FlowRule_DataBar    string = "databar"
+	FlowRule_ColorScale string = "colorscale"
+	FlowRule_IconSet    string = "iconset"
+)
+
+// FlowRule is the `cf` option, an Excel conditional format over the rendered
+// area, such as `databar(#638EC6)`, `colorscale(#F8696B,#FFEB84,#63BE7B)` or
+// `iconset(3TrafficLights1)`.
+type FlowRule struct {
+	Type string
+	Args []string
+}
+
+var ruleRegExp = regexp.MustCompile(`^(?P<type>databar|colorscale|iconset)(\((?P<args>[^()]*)\))?$`)
+
+func TryParseFlowRule(value string) *FlowRule {
+	value = strings.TrimSpace(value)
+	if !ruleRegExp.MatchString(value) {
+		return nil
+	}
+	match := ruleRegExp.FindStringSubmatch(value)
+	ret := &FlowRule{Type: match[ruleRegExp.SubexpIndex("type")]}
+	if args := match[ruleRegExp.SubexpIndex("args")]; args != "" {
+		for _, arg := range strings.Split(args, ",") {
+			ret.Args = append(ret.Args, strings.TrimSpace(arg))
+		}
+	}
+	switch ret.Type {
+	case FlowRule_DataBar, FlowRule_IconSet:
+		if len(ret.Args) > 1 {
+			return nil
+		}
+	case FlowRule_ColorScale:
+		if len(ret.Args) != 0 && len(ret.Args) != 2 && len(ret.Args) != 3 {
+			return nil
+		}
+	}
+	return ret
+}
+
+func (rule FlowRule) options() excelize.ConditionalFormatOptions {
+	switch rule.Type {
+	case FlowRule_DataBar:
+		color := "#638EC6"
+		if len(rule.Args) > 0 {
+			color = rule.Args[0]
+		}
+		return excelize.ConditionalFormatOptions{Type: "data_bar", Criteria: "=", MinType: "min", MaxType: "max", BarColor: color}
+	case FlowRule_ColorScale:
+		colors := rule.Args
+		if len(colors) == 0 {
+			colors = []string{"#F8696B", "#FFEB84", "#63BE7B"}
+		}
+		if len(colors) == 2 {
+			return excelize.ConditionalFormatOptions{
+				Type: "2_color_scale", Criteria: "=",
+				MinType: "min", MaxType: "max",
+				MinColor: colors[0], MaxColor: colors[1],
+			}
+		}
+		return excelize.ConditionalFormatOptions{
+			Type: "3_color_scale", Criteria: "=",
+			MinType: "min", MidType: "percentile", MaxType: "max", MidValue: "50",
+			MinColor: colors[0], MidColor: colors[1], MaxColor: colors[2],
+		}
+	default:
+		style := "3Arrows"
+		if len(rule.Args) > 0 {
+			style = rule.Args[0]
+		}
+		return excelize.ConditionalFormatOptions{Type: "icon_set", IconStyle: style}
+	}
+}
@@ -0,0 +1,43 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFlowRule(t *testing.T) {
+	tests := []struct {
+		value string
+		want  *FlowRule
+	}{
+		{"databar", &FlowRule{Type: FlowRule_DataBar}},
+		{" databar(#638EC6) ", &FlowRule{Type: FlowRule_DataBar, Args: []string{"#638EC6"}}},
+		{"colorscale(#F8696B, #63BE7B)", &FlowRule{Type: FlowRule_ColorScale, Args: []string{"#F8696B", "#63BE7B"}}},
+		{"iconset(3TrafficLights1)", &FlowRule{Type: FlowRule_IconSet, Args: []string{"3TrafficLights1"}}},
+		{"databar(#000,#fff)", nil},
+		{"colorscale(#000)", nil},
+		{"heatmap", nil},
+	}
+	for _, test := range tests {
+		if got := TryParseFlowRule(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("TryParseFlowRule(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestRuleOptions(t *testing.T) {
+	tests := []struct {
+		rule FlowRule
+		typ  string
+	}{
+		{FlowRule{Type: FlowRule_DataBar}, "data_bar"},
+		{FlowRule{Type: FlowRule_ColorScale}, "3_color_scale"},
+		{FlowRule{Type: FlowRule_ColorScale, Args: []string{"#000", "#fff"}}, "2_color_scale"},
+		{FlowRule{Type: FlowRule_IconSet}, "icon_set"},
+	}
+	for _, test := range tests {
+		if got := test.rule.options(); got.Type != test.typ {
+			t.Errorf("options(%+v).Type = %q, want %q", test.rule, got.Type, test.typ)
+		}
+	}
+}
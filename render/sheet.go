@@ -0,0 +1,174 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrDuplicateSheetName = errors.New("duplicate sheet name")
+
+// SheetBlock is the `{{#sheet [lang] exp as name named [lang] exp}}` marker,
+// the sheet holding it is copied once per element with `name` bound.
+type SheetBlock struct {
+	Name      string
+	Code      string
+	TitleCode string
+}
+
+var sheetRegExp = regexp.MustCompile(`^\{\{#sheet\s+(?P<exp>.+?)\s+as\s+(?P<name>\w+)(\s+named\s+(?P<title>.+?))?\s*\}\}$`)
+
+func TryParseSheetBlock(value string) *SheetBlock {
+	value = strings.TrimSpace(value)
+	if !sheetRegExp.MatchString(value) {
+		return nil
+	}
+	match := sheetRegExp.FindStringSubmatch(value)
+	return &SheetBlock{
+		Name:      match[sheetRegExp.SubexpIndex("name")],
+		Code:      match[sheetRegExp.SubexpIndex("exp")],
+		TitleCode: match[sheetRegExp.SubexpIndex("title")],
+	}
+}
+
+type sheetScope struct {
+	Sheet string
+	Name  string
+	Value any
+}
+
+func findSheetBlock(workbook *excelize.File, sheet string) (*SheetBlock, string, error) {
+	dim, err := workbook.GetSheetDimension(sheet)
+	if err != nil {
+		return nil, "", err
+	}
+	area, err := NewArea(dim)
+	if err != nil {
+		return nil, "", err
+	}
+	for currentRow := area.Top; currentRow <= area.Bottom; currentRow += 1 {
+		for currentCol := area.Left; currentCol <= area.Right; currentCol += 1 {
+			cellName, _ := excelize.CoordinatesToCellName(currentCol, currentRow)
+			value, ok := getCellText(workbook, sheet, cellName)
+			if !ok {
+				continue
+			}
+			if block := TryParseSheetBlock(value); block != nil {
+				return block, cellName, nil
+			}
+		}
+	}
+	return nil, "", nil
+}
+
+// expandSheet copies the sheet once per element of its `{{#sheet}}` marker.
+// The template sheet itself is renamed as the first copy, the others are
+// appended to the end of the workbook. A sheet without marker is returned as is.
+func expandSheet(workbook *excelize.File, sheet string, engine RenderEngine, state *renderState) ([]sheetScope, error) {
+	block, cellName, err := findSheetBlock(workbook, sheet)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return []sheetScope{{Sheet: sheet}}, nil
+	}
+	text, _ := getCellText(workbook, sheet, cellName)
+	// the copies and renames are collected again once needed
+	delete(state.formulas, sheet)
+	if err := workbook.SetCellValue(sheet, cellName, nil); err != nil {
+		return nil, err
+	}
+
+	items, err := engine.Eval(block.Code)
+	list, ok := items.([]any)
+	if !ok {
+		list = []any{items}
+	}
+	if err == nil {
+		err = checkSheetCells(workbook, sheet, len(list), state)
+	}
+	if err != nil {
+		// a failed sheet block keeps the single sheet
+		cellErr := newRenderError(sheet, cellName, text, block.Code, err)
+		if err := state.fail(cellErr); err != nil {
+			return nil, err
+		}
+		return []sheetScope{{Sheet: sheet}}, state.markCell(workbook, cellErr)
+	}
+	if len(list) == 0 {
+		return nil, workbook.DeleteSheet(sheet)
+	}
+
+	index, err := workbook.GetSheetIndex(sheet)
+	if err != nil {
+		return nil, err
+	}
+	scopes := []sheetScope{}
+	for i, item := range list {
+		title := fmt.Sprintf("%s %d", sheet, i+1)
+		if block.TitleCode != "" {
+			if err := engine.SetData(block.Name, item); err != nil {
+				return nil, err
+			}
+			value, err := engine.Eval(block.TitleCode)
+			if err != nil {
+				if err := state.fail(newRenderError(sheet, cellName, text, block.TitleCode, err)); err != nil {
+					return nil, err
+				}
+				value = title
+			}
+			title = fmt.Sprint(value)
+		}
+		if i == 0 {
+			scopes = append(scopes, sheetScope{Sheet: title, Name: block.Name, Value: item})
+			continue
+		}
+		if existing, _ := workbook.GetSheetIndex(title); existing != -1 || strings.EqualFold(title, scopes[0].Sheet) {
+			// a copy with a taken title is skipped
+			err := fmt.Errorf("%w: %s", ErrDuplicateSheetName, title)
+			if err := state.fail(newRenderError(sheet, cellName, text, block.TitleCode, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		newIndex, err := workbook.NewSheet(title)
+		if err != nil {
+			return nil, err
+		}
+		if err := workbook.CopySheet(index, newIndex); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, sheetScope{Sheet: title, Name: block.Name, Value: item})
+	}
+	if scopes[0].Sheet != sheet {
+		if existing, _ := workbook.GetSheetIndex(scopes[0].Sheet); existing != -1 {
+			// the template sheet keeps its name
+			err := fmt.Errorf("%w: %s", ErrDuplicateSheetName, scopes[0].Sheet)
+			if err := state.fail(newRenderError(sheet, cellName, text, block.TitleCode, err)); err != nil {
+				return nil, err
+			}
+			scopes[0].Sheet = sheet
+			return scopes, nil
+		}
+		if err := workbook.SetSheetName(sheet, scopes[0].Sheet); err != nil {
+			return nil, err
+		}
+	}
+	return scopes, nil
+}
+
+// checkSheetCells checks the size of the copies of the sheet.
+func checkSheetCells(workbook *excelize.File, sheet string, copies int, state *renderState) error {
+	dim, err := workbook.GetSheetDimension(sheet)
+	if err != nil {
+		return err
+	}
+	area, err := NewArea(dim)
+	if err != nil {
+		return nil
+	}
+	return state.checkCells(copies*(area.Bottom-area.Top+1), area.Right-area.Left+1)
+}
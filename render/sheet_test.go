@@ -0,0 +1,58 @@
+package render_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/azurity/flow-table/render"
+)
+
+func TestParseSheetBlock(t *testing.T) {
+	block := render.TryParseSheetBlock("{{#sheet [js] data.regions as r named [js] r.name}}")
+	want := &render.SheetBlock{Name: "r", Code: "[js] data.regions", TitleCode: "[js] r.name"}
+	if !reflect.DeepEqual(block, want) {
+		t.Errorf("TryParseSheetBlock = %+v, want %+v", block, want)
+	}
+	block = render.TryParseSheetBlock("{{#sheet [js] data.regions as r}}")
+	want = &render.SheetBlock{Name: "r", Code: "[js] data.regions"}
+	if !reflect.DeepEqual(block, want) {
+		t.Errorf("TryParseSheetBlock = %+v, want %+v", block, want)
+	}
+}
+
+func TestSheetBlock(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{#sheet [js] data.regions as r named [js] r.name}}",
+		"A2": "{{[js] r.total}}",
+		"B2": "{{[js] sheet.name + ':' + sheet.index}}",
+	}, map[string]any{"data": map[string]any{"regions": []any{
+		map[string]any{"name": "North", "total": 10},
+		map[string]any{"name": "South", "total": 20},
+	}}})
+	if got := workbook.GetSheetList(); !reflect.DeepEqual(got, []string{"North", "South"}) {
+		t.Fatalf("sheets = %v", got)
+	}
+	expectCells(t, workbook, "North", map[string]string{"A1": "", "A2": "10", "B2": "North:0"})
+	expectCells(t, workbook, "South", map[string]string{"A1": "", "A2": "20", "B2": "South:1"})
+}
+
+func TestSheetBlockDefaultTitle(t *testing.T) {
+	workbook := mustRender(t, map[string]string{
+		"A1": "{{#sheet [js] [1, 2] as n}}",
+		"A2": "{{[js] n}}",
+	}, nil)
+	if got := workbook.GetSheetList(); !reflect.DeepEqual(got, []string{"Sheet1 1", "Sheet1 2"}) {
+		t.Fatalf("sheets = %v", got)
+	}
+	expectCells(t, workbook, "Sheet1 2", map[string]string{"A2": "2"})
+}
+
+func TestSheetBlockDuplicateTitle(t *testing.T) {
+	_, err := renderCells(t, map[string]string{
+		"A1": `{{#sheet [js] [1, 2] as n named [js] "Same"}}`,
+	}, nil, render.Options{})
+	if !errors.Is(err, render.ErrDuplicateSheetName) {
+		t.Errorf("error = %v, want %v", err, render.ErrDuplicateSheetName)
+	}
+}
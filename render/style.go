@@ -0,0 +1,182 @@
+package render
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// FlowStyledValue is a value returned as `{value: ..., style: {...}}`, the
+// style is applied to its cell on top of the anchor style. The supported style
+// keys are `fill` and `color` (such as `#FFCCCC`), `bold`, `italic`,
+// `underline`, `size` and `align` (`left`, `center` or `right`).
+type FlowStyledValue struct {
+	Value any
+	Style map[string]any
+}
+
+// unwrapStyles replaces the styled values in data by their values, and
+// returns the styles by cell, nil for the cells without a style.
+func unwrapStyles(data [][]any) [][]map[string]any {
+	var ret [][]map[string]any
+	for r, row := range data {
+		for c, value := range row {
+			styled, ok := value.(FlowStyledValue)
+			if !ok {
+				continue
+			}
+			if ret == nil {
+				ret = make([][]map[string]any, len(data))
+			}
+			if ret[r] == nil {
+				ret[r] = make([]map[string]any, len(row))
+			}
+			data[r][c] = styled.Value
+			ret[r][c] = styled.Style
+		}
+	}
+	return ret
+}
+
+// shapeStyles lays out the result of the style expression in the direction of
+// the formula, a single style is applied to every cell.
+func shapeStyles(value any, direct int, rows int, cols int) [][]map[string]any {
+	ret := make([][]map[string]any, rows)
+	for r := range ret {
+		ret[r] = make([]map[string]any, cols)
+	}
+	list, isList := value.([]any)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			item := value
+			if isList {
+				item = nil
+				switch direct {
+				case FlowFormulaDirect_H:
+					if c < len(list) {
+						item = list[c]
+					}
+				case FlowFormulaDirect_V:
+					if r < len(list) {
+						item = list[r]
+					}
+				case FlowFormulaDirect_Table:
+					if r < len(list) {
+						if row, ok := list[r].([]any); ok && c < len(row) {
+							item = row[c]
+						}
+					}
+				}
+			}
+			ret[r][c], _ = item.(map[string]any)
+		}
+	}
+	return ret
+}
+
+func colorValue(value any) (string, bool) {
+	str, ok := value.(string)
+	if !ok || str == "" {
+		return "", false
+	}
+	if !strings.HasPrefix(str, "#") {
+		str = "#" + str
+	}
+	return strings.ToUpper(str), true
+}
+
+func applyStyle(style *excelize.Style, dynamic map[string]any) {
+	if dynamic == nil {
+		return
+	}
+	font := excelize.Font{}
+	if style.Font != nil {
+		font = *style.Font
+	}
+	if color, ok := colorValue(dynamic["fill"]); ok {
+		style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{color}}
+	}
+	if color, ok := colorValue(dynamic["color"]); ok {
+		font.Color = color
+	}
+	if bold, ok := dynamic["bold"].(bool); ok {
+		font.Bold = bold
+	}
+	if italic, ok := dynamic["italic"].(bool); ok {
+		font.Italic = italic
+	}
+	if underline, ok := dynamic["underline"].(bool); ok {
+		font.Underline = ""
+		if underline {
+			font.Underline = "single"
+		}
+	}
+	switch size := dynamic["size"].(type) {
+	case float64:
+		font.Size = size
+	case int64:
+		font.Size = float64(size)
+	}
+	style.Font = &font
+	if align, ok := dynamic["align"].(string); ok {
+		alignment := excelize.Alignment{}
+		if style.Alignment != nil {
+			alignment = *style.Alignment
+		}
+		alignment.Horizontal = align
+		style.Alignment = &alignment
+	}
+}
+
+type styleKey struct {
+	Base    int
+	NumFmt  string
+	Dynamic string
+}
+
+// styleCache holds the styles derived from the template styles, so each
+// distinct combination is created only once per workbook.
+type styleCache struct {
+	ids map[styleKey]int
+}
+
+func newStyleCache() *styleCache {
+	return &styleCache{ids: map[styleKey]int{}}
+}
+
+// get returns the base style with the number format and the dynamic style applied.
+func (cache *styleCache) get(workbook *excelize.File, base int, numFmt string, dynamic map[string]any) (int, error) {
+	key := styleKey{Base: base, NumFmt: numFmt}
+	if dynamic != nil {
+		raw, err := json.Marshal(dynamic)
+		if err != nil {
+			return 0, err
+		}
+		key.Dynamic = string(raw)
+	}
+	if id, ok := cache.ids[key]; ok {
+		return id, nil
+	}
+	style, err := workbook.GetStyle(base)
+	if err != nil {
+		return 0, err
+	}
+	newStyle := &excelize.Style{
+		Border:        style.Border,
+		Fill:          style.Fill,
+		Font:          style.Font,
+		Alignment:     style.Alignment,
+		Protection:    style.Protection,
+		NumFmt:        0,
+		DecimalPlaces: style.DecimalPlaces,
+		CustomNumFmt:  &numFmt,
+	}
+	applyStyle(newStyle, dynamic)
+	id, err := workbook.NewStyle(newStyle)
+	if err != nil {
+		return 0, err
+	}
+	cache.ids[key] = id
+	return id, nil
+}
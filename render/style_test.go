@@ -0,0 +1,83 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestUnwrapStyles(t *testing.T) {
+	data := [][]any{{1, FlowStyledValue{Value: 2, Style: map[string]any{"bold": true}}}}
+	styles := unwrapStyles(data)
+	if !reflect.DeepEqual(data, [][]any{{1, 2}}) {
+		t.Errorf("data = %v", data)
+	}
+	if !reflect.DeepEqual(styles, [][]map[string]any{{nil, {"bold": true}}}) {
+		t.Errorf("styles = %v", styles)
+	}
+	if styles := unwrapStyles([][]any{{1}}); styles != nil {
+		t.Errorf("styles without styled values = %v", styles)
+	}
+}
+
+func TestShapeStyles(t *testing.T) {
+	red := map[string]any{"fill": "red"}
+	blue := map[string]any{"fill": "blue"}
+	tests := []struct {
+		value  any
+		direct int
+		rows   int
+		cols   int
+		want   [][]map[string]any
+	}{
+		{red, FlowFormulaDirect_V, 2, 1, [][]map[string]any{{red}, {red}}},
+		{[]any{red, nil, blue}, FlowFormulaDirect_V, 2, 1, [][]map[string]any{{red}, {nil}}},
+		{[]any{red, blue}, FlowFormulaDirect_H, 1, 3, [][]map[string]any{{red, blue, nil}}},
+		{[]any{[]any{red}, []any{nil, blue}}, FlowFormulaDirect_Table, 2, 2, [][]map[string]any{{red, nil}, {nil, blue}}},
+		{"not a style", FlowFormulaDirect_Cell, 1, 1, [][]map[string]any{{nil}}},
+	}
+	for i, test := range tests {
+		if got := shapeStyles(test.value, test.direct, test.rows, test.cols); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d shapeStyles = %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestApplyStyle(t *testing.T) {
+	style := &excelize.Style{Font: &excelize.Font{Family: "Arial"}}
+	applyStyle(style, map[string]any{
+		"fill":      "ffcccc",
+		"color":     "#00f",
+		"bold":      true,
+		"underline": true,
+		"size":      int64(14),
+		"align":     "center",
+	})
+	want := &excelize.Style{
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#FFCCCC"}},
+		Font:      &excelize.Font{Family: "Arial", Color: "#00F", Bold: true, Underline: "single", Size: 14},
+		Alignment: &excelize.Alignment{Horizontal: "center"},
+	}
+	if !reflect.DeepEqual(style, want) {
+		t.Errorf("style = %+v, want %+v", style, want)
+	}
+}
+
+func TestStyleCache(t *testing.T) {
+	workbook := excelize.NewFile()
+	cache := newStyleCache()
+	first, err := cache.get(workbook, 0, "0.00", map[string]any{"bold": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := cache.get(workbook, 0, "0.00", map[string]any{"bold": true})
+	other, _ := cache.get(workbook, 0, "0.00", map[string]any{"bold": false})
+	if first != second || first == other {
+		t.Errorf("style ids = %d %d %d", first, second, other)
+	}
+	style, err := workbook.GetStyle(first)
+	if err != nil || style.Font == nil || !style.Font.Bold || style.CustomNumFmt == nil || *style.CustomNumFmt != "0.00" {
+		t.Errorf("style = %+v, %v", style, err)
+	}
+}